@@ -42,6 +42,11 @@ import (
 type SmartContract struct {
 }
 
+// New owners must have a claim verified on the identity chaincode, by an attester accredited under OWNER_TRUST_ROOT
+const IDENTITY_CC = "id"
+const OWNER_CLAIM = "fullname"
+const OWNER_TRUST_ROOT = "GOVERNMENT"
+
 // Define the car structure, with 4 properties.  Structure tags are used by encoding/json library
 type Car struct {
 	Make   string `json:"make"`
@@ -181,6 +186,10 @@ func (s *SmartContract) changeCarOwner(APIstub shim.ChaincodeStubInterface, args
 		return shim.Error("Incorrect number of arguments. Expecting 2")
 	}
 
+	if err := verifyOwner(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	carAsBytes, _ := APIstub.GetState(args[0])
 	car := Car{}
 
@@ -193,6 +202,28 @@ func (s *SmartContract) changeCarOwner(APIstub shim.ChaincodeStubInterface, args
 	return shim.Success(nil)
 }
 
+/*
+ * verifyOwner asks the identity chaincode whether owner, an identity key, has a verified OWNER_CLAIM
+ */
+func verifyOwner(APIstub shim.ChaincodeStubInterface, owner string) error {
+	args := [][]byte{[]byte("isClaimVerified"), []byte(owner), []byte(OWNER_CLAIM), []byte(""), []byte(OWNER_TRUST_ROOT)}
+	response := APIstub.InvokeChaincode(IDENTITY_CC, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("Failed to verify the identity of %s: %s", owner, response.Message)
+	}
+	verdict := struct {
+		Verified bool   `json:"verified"`
+		Reason   string `json:"reason"`
+	}{}
+	if err := json.Unmarshal(response.Payload, &verdict); err != nil {
+		return err
+	}
+	if !verdict.Verified {
+		return fmt.Errorf("%s has no verified identity: %s", owner, verdict.Reason)
+	}
+	return nil
+}
+
 // The main function is only relevant in unit test mode. Only included here for completeness.
 func main() {
 
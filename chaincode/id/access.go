@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * ACCESS_LOG is the composite key object type of the reads of shared claims. Reads made with a
+ * pairwise pseudonym are logged in the private data collection, the public log would otherwise
+ * tie the pseudonym of the transaction to the user key.
+ */
+const ACCESS_LOG = "accessLog~user~txId"
+
+// AccessLogEntry records a relying party reading claims shared by a user, and the client that read them
+type AccessLogEntry struct {
+	RelyingParty string   `json:"relyingParty"`
+	CallerMSP    string   `json:"callerMsp"`
+	Caller       string   `json:"caller"`
+	Claims       []string `json:"claims"`
+	Timestamp    int64    `json:"timestamp"`
+	TxID         string   `json:"txId"`
+}
+
+/*
+ * ACCESS SHARED CLAIMS, returns the claims shared with the relying party and logs the access.
+ * Must be submitted as a transaction for the access to be recorded, by a client of the org the
+ * relying party is registered with.
+ * args: 0 => (idClient or pairwise pseudonym), 1 => (relyingParty), 2 => (token, transient map only), optional 3 => (ClaimNames, comma separated, all shared claims when empty)
+ * The token is only accepted in the transient map ("token"), it is spliced in as args[2].
+ */
+func (s *SmartContract) accessSharedClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	args, err := transientArgs(APIstub, args, 2, TRANSIENT_TOKEN)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkArgs("accessSharedClaim", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	callerMSP, caller, err := callerParty(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	user, err := resolveUser(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shared := id.Infoshared[args[1]]
+	if len(shared) == 0 {
+		return shim.Error("Nothing was shared with " + args[1])
+	}
+
+	requested := splitList(optionalArg(args, 3))
+	explicit := len(requested) > 0
+	if !explicit {
+		for claim := range shared {
+			requested = append(requested, claim)
+		}
+		// map order differs between endorsers, the log entry must not
+		sort.Strings(requested)
+	}
+	claims := make(map[string]string)
+	names := []string{}
+	redeemed := false
+	for _, claim := range requested {
+		credential, ok := shared[claim]
+		// claims shared under a pseudonym can not be read with the user key
+		if !ok || !credential.matches(args[2]) || (credential.Pseudonymous && args[0] == user) {
+			if explicit {
+				return shim.Error(fmt.Sprintf("Claim %s is not shared with %s", claim, args[1]))
+			}
+			continue
+		}
+		if err := credential.usable(now); err != nil {
+			if explicit {
+				return shim.Error(fmt.Sprintf("Access to %s: %s", claim, err.Error()))
+			}
+			continue
+		}
+		// reading a claim uses up a single use token
+		if credential.SingleUse {
+			credential.Redeemed = now
+			shared[claim] = credential
+			redeemed = true
+		}
+		if value, exist := id.Claims[claim]; exist {
+			claims[claim] = value.Value
+			names = append(names, claim)
+		}
+	}
+	if len(names) == 0 {
+		return shim.Error("No valid shared claims for " + args[1])
+	}
+
+	if redeemed {
+		if err := putID(APIstub, user, id); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	entry := AccessLogEntry{RelyingParty: args[1], CallerMSP: callerMSP, Caller: caller, Claims: names, Timestamp: now, TxID: APIstub.GetTxID()}
+	if err := logAccess(APIstub, user, entry, user != args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := recordUsage(APIstub, args[1], USAGE_ACCESS, 1); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	jsonData, _ := json.Marshal(claims)
+	jsonUser, _ := json.Marshal(args[0])
+	jsonResp := "{\"user\": " + string(jsonUser) + ", \"claims\":" + string(jsonData) + "}"
+	return shim.Success([]byte(jsonResp))
+}
+
+/*
+ * QUERY WHO ACCESSED THE SHARED CLAIMS OF A USER AND WHEN. The reads made with a pseudonym are
+ * only listed when the owner's secret is sent in the transient map ("secret").
+ * args: 0 => (idClient), optional 1 => (relyingParty)
+ */
+func (s *SmartContract) queryAccessLog(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryAccessLog", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := ownerQuery(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(ACCESS_LOG, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	indexes := []shim.StateQueryIteratorInterface{resultsIterator}
+	if owner {
+		privateIterator, err := APIstub.GetPrivateDataByPartialCompositeKey(PRIVATE_COLLECTION, ACCESS_LOG, []string{args[0]})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		defer privateIterator.Close()
+		indexes = append(indexes, privateIterator)
+	}
+
+	// buffer is a JSON array containing the log entries
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	first := true
+	for _, iterator := range indexes {
+		for iterator.HasNext() {
+			queryResponse, err := iterator.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			entry := AccessLogEntry{}
+			if err := strictUnmarshal(queryResponse.Value, &entry); err != nil {
+				return shim.Error(fmt.Sprintf("Corrupted access log %s: %s", queryResponse.Key, err.Error()))
+			}
+			if len(args) == 2 && entry.RelyingParty != args[1] {
+				continue
+			}
+			if !first {
+				buffer.WriteString(", ")
+			}
+			buffer.Write(queryResponse.Value)
+			first = false
+		}
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
+// logAccess records entry in the access log of the user, in the private data collection when the read was pseudonymous
+func logAccess(APIstub shim.ChaincodeStubInterface, user string, entry AccessLogEntry, pseudonymous bool) error {
+	key, err := APIstub.CreateCompositeKey(ACCESS_LOG, []string{user, entry.TxID})
+	if err != nil {
+		return err
+	}
+	entryAsBytes, _ := json.Marshal(entry)
+	if pseudonymous {
+		return APIstub.PutPrivateData(PRIVATE_COLLECTION, key, entryAsBytes)
+	}
+	return APIstub.PutState(key, entryAsBytes)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTokenOnlyInTransientMap(t *testing.T) {
+	stub := newSharingStub(t)
+	message := stub.mustFail("shareinfo", "alice", "rp", "email", "t1")
+	if message != "Argument token of shareinfo must be sent in the transient map as token" {
+		t.Errorf("a positional token was accepted: %s", message)
+	}
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+
+	stub.mustFail("accessSharedClaim", "alice", "rp", "t1")
+	stub.mustFail("redeemShareToken", "alice", "rp", "email", "t1")
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("redeemShareToken", "alice", "rp", "email")
+
+	description := []FunctionDescription{}
+	if err := json.Unmarshal(stub.mustInvoke("describe"), &description); err != nil {
+		t.Fatal(err)
+	}
+	for _, function := range description {
+		for _, arg := range function.Args {
+			if arg.Name == "token" && !arg.Sealed {
+				t.Errorf("the token of %s is not sealed", function.Name)
+			}
+		}
+	}
+}
+
+func TestAccessSharedClaim(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+
+	stub.as("Org2MSP", "")
+	stub.with(TRANSIENT_TOKEN, "t1")
+	if message := stub.mustFail("accessSharedClaim", "alice", "rp"); message != "Only clients of Org1MSP can act as rp" {
+		t.Errorf("a client of another org read the claims of rp: %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.with(TRANSIENT_TOKEN, "t2")
+	stub.mustFail("accessSharedClaim", "alice", "rp")
+
+	stub.with(TRANSIENT_TOKEN, "t1")
+	result := struct {
+		User   string            `json:"user"`
+		Claims map[string]string `json:"claims"`
+	}{}
+	if err := json.Unmarshal(stub.mustInvoke("accessSharedClaim", "alice", "rp"), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Claims["email"] != "alice@example.com" {
+		t.Errorf("unexpected claims %+v", result)
+	}
+
+	entries := []AccessLogEntry{}
+	if err := json.Unmarshal(stub.mustInvoke("queryAccessLog", "alice"), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].RelyingParty != "rp" || entries[0].CallerMSP != TEST_ORG || len(entries[0].Claims) != 1 {
+		t.Errorf("unexpected access log %+v", entries)
+	}
+}
+
+func TestPseudonymousAccessLogIsPrivate(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1", TRANSIENT_SECRET, "alice")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+	pseudonym := pairwisePseudonym([]byte("alice"), "rp")
+
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("accessSharedClaim", pseudonym, "rp")
+	for key := range stub.State {
+		if strings.HasPrefix(key, "\x00"+ACCESS_LOG) {
+			t.Errorf("a pseudonymous read was logged in world state: %q", key)
+		}
+	}
+
+	queryLog := func(pairs ...string) []AccessLogEntry {
+		stub.with(pairs...)
+		entries := []AccessLogEntry{}
+		if err := json.Unmarshal(stub.mustInvoke("queryAccessLog", "alice"), &entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+	if entries := queryLog(); len(entries) != 0 {
+		t.Errorf("pseudonymous reads were listed without the secret: %+v", entries)
+	}
+	if entries := queryLog(TRANSIENT_SECRET, "alice"); len(entries) != 1 || entries[0].RelyingParty != "rp" {
+		t.Errorf("unexpected access log %+v", entries)
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("queryAccessLog", "alice")
+}
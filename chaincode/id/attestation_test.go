@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// newAttesterStub registers the attester acme of TEST_ORG and creates alice
+func newAttesterStub(t *testing.T) *testStub {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "acme", TEST_ORG)
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+	return stub
+}
+
+func TestBucketPolicySetAtRegistration(t *testing.T) {
+	stub := newAttesterStub(t)
+	if stub.State[ATTEST+"acme"] == nil {
+		t.Fatal("the bucket was not created with the party")
+	}
+	stub.as(TEST_ORG, GOVERNANCE)
+	policy := struct {
+		Orgs []string `json:"orgs"`
+	}{}
+	if err := json.Unmarshal(stub.mustInvoke("queryKeyPolicy", ATTEST+"acme"), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Orgs) != 1 || policy.Orgs[0] != TEST_ORG {
+		t.Errorf("unexpected policy of the bucket %+v", policy)
+	}
+}
+
+func TestAttestAsAttesterOrg(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.as("Org2MSP", "")
+	if message := stub.mustFail("requestAttestation", "acme", "alice", "fullname", "url"); message != "Only clients of Org1MSP can act for alice" {
+		t.Errorf("a client of another org requested an attestation of alice: %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "docid", "url")
+
+	stub.as("Org2MSP", "")
+	for _, args := range [][]string{
+		{"createAttestation", "acme", "alice", "fullname", "hash"},
+		{"rejectAttestation", "acme", "alice", "docid"},
+		{"revokeAttestation", "acme", "alice", "fullname"},
+	} {
+		if message := stub.mustFail(args[0], args[1:]...); message != "Only clients of Org1MSP can act as acme" {
+			t.Errorf("%s as a client of another org: %s", args[0], message)
+		}
+	}
+	stub.as(TEST_ORG, "")
+	if message := stub.mustFail("createAttestation", "unknown", "alice", "fullname", "hash"); message != "unknown is not a registered party" {
+		t.Errorf("an unregistered attester attested: %s", message)
+	}
+	stub.mustInvoke("createAttestation", "acme", "alice", "fullname", "hash")
+	stub.mustInvoke("rejectAttestation", "acme", "alice", "docid")
+	stub.mustInvoke("revokeAttestation", "acme", "alice", "fullname")
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Billing ledger: relying parties pay per read of shared claims (accessSharedClaim, redeeming a
+ * token is free) and attesters per issued attestation. Every billable event adds a usage delta
+ * row, as in the high-throughput sample, so busy parties do not make transactions conflict on a
+ * shared counter. When a monthly period is over, closeBillingPeriod folds its rows into one
+ * invoice per party, which the party can dispute.
+ */
+
+// Composite key prefixes of the billing ledger
+const (
+	USAGE          = "usage~period~party~kind~quantity~txId"
+	BILLING_RATE   = "billingRate~kind"
+	BILLING_PERIOD = "billingPeriod~period"
+	INVOICE        = "invoice~party~period"
+)
+
+// Billable kinds of usage
+const (
+	USAGE_ACCESS      = "access"
+	USAGE_ATTESTATION = "attestation"
+)
+
+// PERIOD_FORMAT is the layout of billing periods, one per calendar month in UTC
+const PERIOD_FORMAT = "2006-01"
+
+// InvoiceLine is the usage of one kind in a period, amounts are in the smallest currency unit
+type InvoiceLine struct {
+	Quantity  int64 `json:"quantity"`
+	UnitPrice int64 `json:"unitPrice"`
+	Amount    int64 `json:"amount"`
+}
+
+// Invoice is the usage of a party in a period, final once the period is closed
+type Invoice struct {
+	Party    string                 `json:"party"`
+	Period   string                 `json:"period"`
+	Lines    map[string]InvoiceLine `json:"lines"`
+	Total    int64                  `json:"total"`
+	Closed   int64                  `json:"closed,omitempty"`
+	Disputed bool                   `json:"disputed,omitempty"`
+	Dispute  *Dispute               `json:"dispute,omitempty"`
+}
+
+// Dispute is the dispute flag of an invoice
+type Dispute struct {
+	Reason     string `json:"reason"`
+	RaisedBy   string `json:"raisedBy"`
+	Raised     int64  `json:"raised"`
+	Resolution string `json:"resolution,omitempty"`
+	Resolved   int64  `json:"resolved,omitempty"`
+}
+
+// billingPeriod is the period of a transaction time
+func billingPeriod(now int64) string {
+	return time.Unix(now, 0).UTC().Format(PERIOD_FORMAT)
+}
+
+/*
+ * recordUsage adds a usage delta row of quantity events of kind for party. The period is taken
+ * from the transaction time, which the client sets, so usage is refused once that period is closed.
+ */
+func recordUsage(APIstub shim.ChaincodeStubInterface, party string, kind string, quantity int64) error {
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	period := billingPeriod(now)
+	periodKey, err := APIstub.CreateCompositeKey(BILLING_PERIOD, []string{period})
+	if err != nil {
+		return err
+	}
+	closedAsBytes, err := APIstub.GetState(periodKey)
+	if err != nil {
+		return err
+	}
+	if closedAsBytes != nil {
+		return fmt.Errorf("Billing period %s is closed", period)
+	}
+	key, err := APIstub.CreateCompositeKey(USAGE, []string{period, party, kind, strconv.FormatInt(quantity, 10), APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte{0x00})
+}
+
+/*
+ * SET BILLING RATE (governance admins only), the price of one unit of usage, applied when a period is closed
+ * args: 0 => (kind, access or attestation), 1 => (unitPrice, in the smallest currency unit)
+ */
+func (s *SmartContract) setBillingRate(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("setBillingRate", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[0] != USAGE_ACCESS && args[0] != USAGE_ATTESTATION {
+		return shim.Error(fmt.Sprintf("kind must be %s or %s", USAGE_ACCESS, USAGE_ATTESTATION))
+	}
+	price, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || price < 0 {
+		return shim.Error("unitPrice must be a positive number")
+	}
+	key, err := APIstub.CreateCompositeKey(BILLING_RATE, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := APIstub.PutState(key, []byte(strconv.FormatInt(price, 10))); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * CLOSE BILLING PERIOD (governance admins only), writes the invoices of every party of a past period
+ * args: 0 => (period, YYYY-MM)
+ */
+func (s *SmartContract) closeBillingPeriod(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("closeBillingPeriod", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	period := args[0]
+	if _, err := time.Parse(PERIOD_FORMAT, period); err != nil {
+		return shim.Error("period must be formatted as YYYY-MM")
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if period >= billingPeriod(now) {
+		return shim.Error(fmt.Sprintf("Period %s is not over yet", period))
+	}
+	periodKey, err := APIstub.CreateCompositeKey(BILLING_PERIOD, []string{period})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	closedAsBytes, err := APIstub.GetState(periodKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if closedAsBytes != nil {
+		return shim.Error(fmt.Sprintf("Period %s is already closed", period))
+	}
+
+	invoices, err := aggregateUsage(APIstub, []string{period})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	parties := make([]string, 0, len(invoices))
+	for party := range invoices {
+		parties = append(parties, party)
+	}
+	sort.Strings(parties)
+	for _, party := range parties {
+		invoice := invoices[party]
+		invoice.Closed = now
+		if err := putInvoice(APIstub, *invoice); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := APIstub.PutState(periodKey, []byte(strconv.FormatInt(now, 10))); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	summary, _ := json.Marshal(map[string]interface{}{"period": period, "invoices": len(parties)})
+	return shim.Success(summary)
+}
+
+/*
+ * QUERY INVOICE of a party for a period. The invoice of an open period is the usage so far at the
+ * current rates.
+ * args: 0 => (party), 1 => (period, YYYY-MM)
+ */
+func (s *SmartContract) queryInvoice(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryInvoice", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice, err := getInvoice(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice == nil {
+		invoices, err := aggregateUsage(APIstub, []string{args[1], args[0]})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		invoice = &Invoice{Party: args[0], Period: args[1], Lines: map[string]InvoiceLine{}}
+		if open, ok := invoices[args[0]]; ok {
+			invoice = open
+		}
+	}
+	invoiceAsBytes, _ := json.Marshal(invoice)
+	return shim.Success(invoiceAsBytes)
+}
+
+/*
+ * QUERY INVOICES of a party, the invoices of its closed periods
+ * args: 0 => (party)
+ */
+func (s *SmartContract) queryInvoices(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryInvoices", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(INVOICE, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	invoices := []Invoice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		invoice := Invoice{}
+		if err := json.Unmarshal(queryResponse.Value, &invoice); err != nil {
+			return shim.Error(err.Error())
+		}
+		invoices = append(invoices, invoice)
+	}
+	invoicesAsBytes, _ := json.Marshal(invoices)
+	return shim.Success(invoicesAsBytes)
+}
+
+/*
+ * DISPUTE INVOICE, the party flags its invoice of a closed period as disputed, as a client of its org
+ * args: 0 => (party), 1 => (period, YYYY-MM), 2 => (reason)
+ */
+func (s *SmartContract) disputeInvoice(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("disputeInvoice", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	org, _, err := callerParty(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice, err := getInvoice(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice == nil {
+		return shim.Error(fmt.Sprintf("Invoice of %s for %s not Found!", args[0], args[1]))
+	}
+	if invoice.Disputed {
+		return shim.Error("Invoice is already disputed")
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice.Disputed = true
+	invoice.Dispute = &Dispute{Reason: args[2], RaisedBy: org, Raised: now}
+	if err := putInvoice(APIstub, *invoice); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * RESOLVE INVOICE DISPUTE (governance admins only), clears the dispute flag and records the resolution
+ * args: 0 => (party), 1 => (period, YYYY-MM), 2 => (resolution)
+ */
+func (s *SmartContract) resolveInvoiceDispute(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("resolveInvoiceDispute", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice, err := getInvoice(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if invoice == nil || !invoice.Disputed {
+		return shim.Error(fmt.Sprintf("No dispute of the invoice of %s for %s", args[0], args[1]))
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	invoice.Disputed = false
+	invoice.Dispute.Resolution = args[2]
+	invoice.Dispute.Resolved = now
+	if err := putInvoice(APIstub, *invoice); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * aggregateUsage sums the usage rows under the partial key (period, optionally party) into
+ * invoices priced at the current rates
+ */
+func aggregateUsage(APIstub shim.ChaincodeStubInterface, keys []string) (map[string]*Invoice, error) {
+	rates := map[string]int64{}
+	for _, kind := range []string{USAGE_ACCESS, USAGE_ATTESTATION} {
+		rate, err := billingRate(APIstub, kind)
+		if err != nil {
+			return nil, err
+		}
+		rates[kind] = rate
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(USAGE, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	invoices := map[string]*Invoice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		period, party, kind := keyParts[0], keyParts[1], keyParts[2]
+		quantity, err := strconv.ParseInt(keyParts[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		invoice, ok := invoices[party]
+		if !ok {
+			invoice = &Invoice{Party: party, Period: period, Lines: map[string]InvoiceLine{}}
+			invoices[party] = invoice
+		}
+		line := invoice.Lines[kind]
+		line.Quantity += quantity
+		line.UnitPrice = rates[kind]
+		line.Amount = line.Quantity * line.UnitPrice
+		invoice.Lines[kind] = line
+	}
+	for _, invoice := range invoices {
+		invoice.Total = 0
+		for _, line := range invoice.Lines {
+			invoice.Total += line.Amount
+		}
+	}
+	return invoices, nil
+}
+
+func billingRate(APIstub shim.ChaincodeStubInterface, kind string) (int64, error) {
+	key, err := APIstub.CreateCompositeKey(BILLING_RATE, []string{kind})
+	if err != nil {
+		return 0, err
+	}
+	rateAsBytes, err := APIstub.GetState(key)
+	if err != nil || rateAsBytes == nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(rateAsBytes), 10, 64)
+}
+
+func getInvoice(APIstub shim.ChaincodeStubInterface, party string, period string) (*Invoice, error) {
+	key, err := APIstub.CreateCompositeKey(INVOICE, []string{party, period})
+	if err != nil {
+		return nil, err
+	}
+	invoiceAsBytes, err := APIstub.GetState(key)
+	if err != nil || invoiceAsBytes == nil {
+		return nil, err
+	}
+	invoice := Invoice{}
+	if err := json.Unmarshal(invoiceAsBytes, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func putInvoice(APIstub shim.ChaincodeStubInterface, invoice Invoice) error {
+	key, err := APIstub.CreateCompositeKey(INVOICE, []string{invoice.Party, invoice.Period})
+	if err != nil {
+		return err
+	}
+	invoiceAsBytes, _ := json.Marshal(invoice)
+	return APIstub.PutState(key, invoiceAsBytes)
+}
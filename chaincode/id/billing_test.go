@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func queryInvoice(t *testing.T, stub *testStub, party string, period string) Invoice {
+	t.Helper()
+	invoice := Invoice{}
+	if err := json.Unmarshal(stub.mustInvoke("queryInvoice", party, period), &invoice); err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+func TestAttestationsAreBilled(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setBillingRate", USAGE_ATTESTATION, "5")
+	stub.mustFail("setBillingRate", "storage", "5")
+	stub.as(TEST_ORG, "")
+	for _, claim := range []string{"fullname", "docid"} {
+		stub.mustInvoke("requestAttestation", "acme", "alice", claim, "url")
+		stub.mustInvoke("createAttestation", "acme", "alice", claim, "hash")
+	}
+
+	timestamp, _ := stub.GetTxTimestamp()
+	invoice := queryInvoice(t, stub, "acme", billingPeriod(timestamp.Seconds))
+	if line := invoice.Lines[USAGE_ATTESTATION]; line.Quantity != 2 || line.UnitPrice != 5 || invoice.Total != 10 {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+	stub.as(TEST_ORG, GOVERNANCE)
+	if message := stub.mustFail("closeBillingPeriod", invoice.Period); message != "Period "+invoice.Period+" is not over yet" {
+		t.Errorf("unexpected error %s", message)
+	}
+}
+
+func TestDisputeInvoiceAsParty(t *testing.T) {
+	stub := newAttesterStub(t)
+	// usage of a past period
+	stub.start()
+	for i := 0; i < 3; i++ {
+		key, _ := stub.CreateCompositeKey(USAGE, []string{"2020-01", "acme", USAGE_ATTESTATION, "1", "tx" + strconv.Itoa(i)})
+		stub.PutState(key, []byte{0x00})
+	}
+	stub.end()
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setBillingRate", USAGE_ATTESTATION, "2")
+	stub.mustInvoke("closeBillingPeriod", "2020-01")
+	if message := stub.mustFail("closeBillingPeriod", "2020-01"); message != "Period 2020-01 is already closed" {
+		t.Errorf("unexpected error %s", message)
+	}
+	// the rates of a closed period no longer change its invoices
+	stub.mustInvoke("setBillingRate", USAGE_ATTESTATION, "3")
+	if invoice := queryInvoice(t, stub, "acme", "2020-01"); invoice.Total != 6 || invoice.Closed == 0 {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+
+	stub.as("Org2MSP", "")
+	if message := stub.mustFail("disputeInvoice", "acme", "2020-01", "too much"); message != "Only clients of Org1MSP can act as acme" {
+		t.Errorf("a client of another org disputed the invoice of acme: %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.mustFail("disputeInvoice", "acme", "2019-12", "too much")
+	stub.mustInvoke("disputeInvoice", "acme", "2020-01", "too much")
+	if message := stub.mustFail("disputeInvoice", "acme", "2020-01", "again"); message != "Invoice is already disputed" {
+		t.Errorf("unexpected error %s", message)
+	}
+	invoice := queryInvoice(t, stub, "acme", "2020-01")
+	if !invoice.Disputed || invoice.Dispute.RaisedBy != TEST_ORG {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+
+	stub.mustFail("resolveInvoiceDispute", "acme", "2020-01", "credited")
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("resolveInvoiceDispute", "acme", "2020-01", "credited")
+	if invoice := queryInvoice(t, stub, "acme", "2020-01"); invoice.Disputed || invoice.Dispute.Resolution != "credited" {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+}
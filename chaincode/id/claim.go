@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+ * Every claim keeps where its value comes from: the user sets it ("self") and an attester that
+ * attests it becomes its source, with a reference to its attester_<id> document. Changing the
+ * value makes it self asserted again.
+ * createAttestation then writes the ID of the user too, so it also needs the endorsement the
+ * key policy of the ID asks for.
+ */
+
+// SOURCE_SELF is the source of a claim value set by the user
+const SOURCE_SELF = "self"
+
+/*
+ * setClaim sets the value of a claim of id with the metadata of the transaction, callers save the ID afterwards
+ */
+func setClaim(APIstub shim.ChaincodeStubInterface, id *ID, name string, value string) error {
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return err
+	}
+	claim, exist := id.Claims[name]
+	if !exist {
+		claim.Created = now
+	}
+	claim.Value = value
+	claim.Source = SOURCE_SELF
+	claim.SetBy = org
+	claim.Updated = now
+	claim.TxID = APIstub.GetTxID()
+	claim.Attestation = ""
+	claim.Type = ""
+	claim.Elements = nil
+	id.Claims[name] = claim
+	return nil
+}
+
+/*
+ * linkAttestation records on the claim of user, or on the element <claim>#<elementId> of an array
+ * claim, that attester attested it, nothing is done when the user or the claim does not exist (yet)
+ */
+func linkAttestation(APIstub shim.ChaincodeStubInterface, user string, name string, attester string) error {
+	return updateClaimAttestation(APIstub, user, name, func(source *string, attestation *string) bool {
+		*source = attester
+		*attestation = ATTEST + attester
+		return true
+	})
+}
+
+/*
+ * unlinkAttestation makes the claim of user self asserted again when attester was its source
+ */
+func unlinkAttestation(APIstub shim.ChaincodeStubInterface, user string, name string, attester string) error {
+	return updateClaimAttestation(APIstub, user, name, func(source *string, attestation *string) bool {
+		if *attestation != ATTEST+attester {
+			return false
+		}
+		*source = SOURCE_SELF
+		*attestation = ""
+		return true
+	})
+}
+
+func updateClaimAttestation(APIstub shim.ChaincodeStubInterface, user string, name string, update func(source *string, attestation *string) bool) error {
+	idAsBytes, err := APIstub.GetState(user)
+	if err != nil || idAsBytes == nil {
+		return err
+	}
+	id, err := decodeID(user, idAsBytes)
+	if err != nil {
+		return err
+	}
+	name, elementID := splitElement(name)
+	claim, exist := id.Claims[name]
+	if !exist || id.RedirectTo != "" {
+		return nil
+	}
+	source, attestation := &claim.Source, &claim.Attestation
+	if elementID != "" {
+		source, attestation = nil, nil
+		for i := range claim.Elements {
+			if claim.Elements[i].ID == elementID {
+				source, attestation = &claim.Elements[i].Source, &claim.Elements[i].Attestation
+			}
+		}
+	}
+	if source == nil || !update(source, attestation) {
+		return nil
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	claim.Updated = now
+	claim.TxID = APIstub.GetTxID()
+	id.Claims[name] = claim
+	return putID(APIstub, user, id)
+}
+
+// claimValues returns the values of the claims without their metadata
+func claimValues(claims map[string]Claim) map[string]string {
+	values := make(map[string]string, len(claims))
+	for name, claim := range claims {
+		values[name] = claim.Value
+	}
+	return values
+}
+
+func claimNames(claims map[string]Claim) []string {
+	names := make([]string, 0, len(claims))
+	for name := range claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
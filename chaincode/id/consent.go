@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// CONSENT is the composite key object type of the consent requests of a user
+const CONSENT = "consentRequest~user~requestId"
+
+// Status of a consent request
+const (
+	CONSENT_PENDING  = "pending"
+	CONSENT_APPROVED = "approved"
+	CONSENT_DECLINED = "declined"
+)
+
+// ConsentRequest is a relying party asking a user to share some claims
+type ConsentRequest struct {
+	RequestID    string   `json:"requestId"`
+	User         string   `json:"user"`
+	RelyingParty string   `json:"relyingParty"`
+	Claims       []string `json:"claims"`
+	Purpose      string   `json:"purpose"`
+	Jurisdiction string   `json:"jurisdiction,omitempty"`
+	ValidDays    int      `json:"validDays"`
+	Status       string   `json:"status"`
+	Requested    int64    `json:"requested"`
+	Decided      int64    `json:"decided,omitempty"`
+	// Pseudonymous requests were made with the pairwise pseudonym, they are approved under it
+	Pseudonymous bool `json:"pseudonymous,omitempty"`
+}
+
+/*
+ * REQUEST CONSENT, the request id is the transaction id. The caller must be a client of the org
+ * the relying party is registered with.
+ * args: 0 => (idClient or the pairwise pseudonym of the relying party), 1 => (relyingParty),
+ *       2 => (ClaimNames, comma separated), 3 => (purpose),
+ *       optional 4 => (validDays, the shortest default of the claim schemas when empty), 5 => (jurisdiction)
+ */
+func (s *SmartContract) requestConsent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("requestConsent", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, _, err := callerParty(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the relying party may know the user by its pairwise pseudonym only
+	user, err := resolveUser(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getID(APIstub, user); err != nil {
+		return shim.Error(err.Error())
+	}
+	claims := splitList(args[2])
+	if len(claims) == 0 {
+		return shim.Error("At least one claim must be requested")
+	}
+	for _, claim := range claims {
+		if _, err := getClaimSchema(APIstub, claim); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if args[3] == "" {
+		return shim.Error("The purpose of the request must not be empty")
+	}
+	validDays, err := shareValidDays(APIstub, optionalArg(args, 4), claims)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	requested, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	request := ConsentRequest{
+		RequestID:    APIstub.GetTxID(),
+		User:         user,
+		RelyingParty: args[1],
+		Claims:       claims,
+		Purpose:      args[3],
+		ValidDays:    validDays,
+		Jurisdiction: optionalArg(args, 5),
+		Status:       CONSENT_PENDING,
+		Requested:    requested,
+		Pseudonymous: user != args[0],
+	}
+	if err := putConsentRequest(APIstub, request); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success([]byte(request.RequestID))
+}
+
+/*
+ * QUERY PENDING CONSENT REQUESTS OF A USER
+ * args: 0 => (idClient)
+ */
+func (s *SmartContract) queryConsentRequests(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryConsentRequests", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(CONSENT, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing the pending requests
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	first := true
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		request := ConsentRequest{}
+		if err := strictUnmarshal(queryResponse.Value, &request); err != nil {
+			return shim.Error(fmt.Sprintf("Corrupted consent request %s: %s", queryResponse.Key, err.Error()))
+		}
+		if request.Status != CONSENT_PENDING {
+			continue
+		}
+		if !first {
+			buffer.WriteString(", ")
+		}
+		buffer.Write(queryResponse.Value)
+		first = false
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
+/*
+ * APPROVE CONSENT REQUEST, shares the requested claims with the relying party and returns the consent receipt id.
+ * The owner's secret is sent in the transient map ("secret"), requests made with a pseudonym are
+ * shared under it.
+ * args: 0 => (idClient), 1 => (requestId), 2 => (token, transient map only)
+ */
+func (s *SmartContract) approveConsent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	args, err := transientArgs(APIstub, args, 2, TRANSIENT_TOKEN)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkArgs("approveConsent", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwner(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	request, err := getPendingConsentRequest(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pseudonym := ""
+	if request.Pseudonymous {
+		if pseudonym, err = sharePseudonym(APIstub, args[0], id, request.RelyingParty); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	for _, claim := range request.Claims {
+		if _, exist := id.Claims[claim]; !exist {
+			return shim.Error(fmt.Sprintf("User has no claim %s to share", claim))
+		}
+		credential := Credential{ValidDay: request.ValidDays, Pseudonymous: pseudonym != ""}
+		if err := grantShare(APIstub, &id, request.RelyingParty, claim, args[2], credential); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := decideConsentRequest(APIstub, request, CONSENT_APPROVED); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the request names the user, a receipt under a pseudonym must not point to it
+	method := "consentRequest " + request.RequestID
+	if pseudonym != "" {
+		method = "consentRequest"
+	}
+	receipt, err := issueConsentReceipt(APIstub, request.User, pseudonym, request.RelyingParty, request.Claims, request.Purpose,
+		request.ValidDays, request.Jurisdiction, method)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(receipt.ConsentReceiptID))
+}
+
+/*
+ * DECLINE CONSENT REQUEST
+ * args: 0 => (idClient), 1 => (requestId)
+ * The owner's secret is sent in the transient map ("secret").
+ */
+func (s *SmartContract) declineConsent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("declineConsent", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireOwner(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	request, err := getPendingConsentRequest(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := decideConsentRequest(APIstub, request, CONSENT_DECLINED); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+func getPendingConsentRequest(APIstub shim.ChaincodeStubInterface, user string, requestID string) (ConsentRequest, error) {
+	request := ConsentRequest{}
+	key, err := APIstub.CreateCompositeKey(CONSENT, []string{user, requestID})
+	if err != nil {
+		return request, err
+	}
+	requestAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return request, err
+	}
+	if requestAsBytes == nil {
+		return request, fmt.Errorf("Consent request not Found!")
+	}
+	if err := strictUnmarshal(requestAsBytes, &request); err != nil {
+		return request, fmt.Errorf("Corrupted consent request %s: %s", requestID, err.Error())
+	}
+	if request.Status != CONSENT_PENDING {
+		return request, fmt.Errorf("Consent request was already %s", request.Status)
+	}
+	return request, nil
+}
+
+func decideConsentRequest(APIstub shim.ChaincodeStubInterface, request ConsentRequest, status string) error {
+	decided, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	request.Status = status
+	request.Decided = decided
+	return putConsentRequest(APIstub, request)
+}
+
+func putConsentRequest(APIstub shim.ChaincodeStubInterface, request ConsentRequest) error {
+	key, err := APIstub.CreateCompositeKey(CONSENT, []string{request.User, request.RequestID})
+	if err != nil {
+		return err
+	}
+	requestAsBytes, _ := json.Marshal(request)
+	return APIstub.PutState(key, requestAsBytes)
+}
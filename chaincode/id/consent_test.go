@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// newSharingStub registers the relying party rp of TEST_ORG and the email claim, and creates alice with an email
+func newSharingStub(t *testing.T) *testStub {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "rp", TEST_ORG, TEST_CONTROLLER)
+	stub.mustInvoke("registerClaimSchema", "email", ".+@.+", "", SENSITIVITY_MEDIUM, "", "30")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+	stub.with(TRANSIENT_VALUE, "alice@example.com")
+	stub.mustInvoke("addClaim", "alice", "email")
+	return stub
+}
+
+func queryReceipt(t *testing.T, stub *testStub, receiptID string) ConsentReceipt {
+	t.Helper()
+	receipt := ConsentReceipt{}
+	if err := json.Unmarshal(stub.mustInvoke("queryConsentReceipt", receiptID), &receipt); err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestRequestConsentAsRelyingParty(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.as("Org2MSP", "")
+	if message := stub.mustFail("requestConsent", "alice", "rp", "email", "newsletter"); message != "Only clients of Org1MSP can act as rp" {
+		t.Errorf("a client of another org filed a request as rp: %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.mustFail("requestConsent", "alice", "unknown", "email", "newsletter")
+	requestID := string(stub.mustInvoke("requestConsent", "alice", "rp", "email", "newsletter"))
+
+	requests := []ConsentRequest{}
+	if err := json.Unmarshal(stub.mustInvoke("queryConsentRequests", "alice"), &requests); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].RequestID != requestID || requests[0].ValidDays != 30 || requests[0].Pseudonymous {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+}
+
+func TestDecideConsentAsOwner(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.createID("bob", "P2")
+	requestID := string(stub.mustInvoke("requestConsent", "alice", "rp", "email", "newsletter"))
+
+	for _, function := range []string{"approveConsent", "declineConsent"} {
+		stub.with(TRANSIENT_TOKEN, "token")
+		if message := stub.mustFail(function, "alice", requestID); message != "The secret of alice is required in the transient map" {
+			t.Errorf("%s without the secret: %s", function, message)
+		}
+		stub.with(TRANSIENT_TOKEN, "token", TRANSIENT_SECRET, "bob")
+		stub.mustFail(function, "alice", requestID)
+	}
+
+	stub.with(TRANSIENT_TOKEN, "token", TRANSIENT_SECRET, "alice")
+	receiptID := string(stub.mustInvoke("approveConsent", "alice", requestID))
+	credential, shared := stub.getID("alice").Infoshared["rp"]["email"]
+	if !shared || credential.Pseudonymous || credential.TokenHash != hashToken(credential.Salt, "token") {
+		t.Errorf("unexpected credential %+v", credential)
+	}
+	if receipt := queryReceipt(t, stub, receiptID); receipt.PiiPrincipalID != "alice" || receipt.CollectionMethod != "consentRequest "+requestID {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+	stub.with(TRANSIENT_SECRET, "alice")
+	if message := stub.mustFail("declineConsent", "alice", requestID); message != "Consent request was already approved" {
+		t.Errorf("unexpected error %s", message)
+	}
+}
+
+func TestConsentRequestedUnderPseudonym(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1", TRANSIENT_SECRET, "alice")
+	stub.mustInvoke("shareinfo", "alice", "rp", "fullname", "10")
+	pseudonym := pairwisePseudonym([]byte("alice"), "rp")
+
+	requestID := string(stub.mustInvoke("requestConsent", pseudonym, "rp", "email", "newsletter"))
+	stub.with(TRANSIENT_TOKEN, "t2", TRANSIENT_SECRET, "alice")
+	receiptID := string(stub.mustInvoke("approveConsent", "alice", requestID))
+	if !stub.getID("alice").Infoshared["rp"]["email"].Pseudonymous {
+		t.Errorf("a request made under the pseudonym was shared under the user key")
+	}
+	receipt := queryReceipt(t, stub, receiptID)
+	if receipt.PiiPrincipalID != pseudonym || strings.Contains(receipt.CollectionMethod, requestID) {
+		t.Errorf("the receipt points to the user: %+v", receipt)
+	}
+}
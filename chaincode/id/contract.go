@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Routing table of the identity chaincode: every function is described by its parameters, Invoke
+ * validates the args against them and checks the roles of the caller, and describe returns the
+ * table so clients do not need to read the doc comments of the handlers.
+ */
+
+// DESCRIBE is the query that returns the routing table
+const DESCRIBE = "describe"
+
+// Parameter types of the transaction signatures
+const (
+	TYPE_STRING  = "string"
+	TYPE_INTEGER = "integer"
+	TYPE_BOOLEAN = "boolean"
+	TYPE_LIST    = "list"
+	TYPE_OBJECT  = "object"
+	TYPE_ARRAY   = "array"
+)
+
+/*
+ * Param is a parameter of a transaction, Transient names the transient map key that can carry it
+ * instead. Sealed parameters are only accepted in the transient map.
+ */
+type Param struct {
+	Name      string
+	Type      string
+	Optional  bool
+	Transient string
+	Sealed    bool
+}
+
+/*
+ * Transaction describes a function of the contract. Aliases are older names that keep working,
+ * Roles are the ROLE_ATTR values allowed to call it (anyone when empty).
+ */
+type Transaction struct {
+	Name    string
+	Aliases []string
+	Params  []Param
+	Returns string
+	Submit  bool
+	Roles   []string
+	Handler func(*SmartContract, shim.ChaincodeStubInterface, []string) sc.Response
+}
+
+func str(name string) Param           { return Param{Name: name, Type: TYPE_STRING} }
+func typed(name, typ string) Param    { return Param{Name: name, Type: typ} }
+func optional(name, typ string) Param { return Param{Name: name, Type: typ, Optional: true} }
+func secret(name, key string) Param   { return Param{Name: name, Type: TYPE_STRING, Transient: key} }
+func sealed(name, key string) Param {
+	return Param{Name: name, Type: TYPE_STRING, Transient: key, Sealed: true}
+}
+
+// transactions is the routing table of Invoke, in the order describe lists them
+var transactions = []Transaction{
+	{Name: "initLedger", Submit: true, Handler: (*SmartContract).initLedger},
+	{Name: "createId", Params: []Param{optional("idClient", TYPE_STRING), secret("fullname", TRANSIENT_FULLNAME), secret("docid", TRANSIENT_DOCID)}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).createId},
+	{Name: "addClaim", Params: []Param{str("idClient"), str("claimName"), secret("value", TRANSIENT_VALUE), optional("type", TYPE_STRING)}, Submit: true, Handler: (*SmartContract).addClaim},
+	{Name: "addClaimElement", Params: []Param{str("idClient"), str("claimName"), secret("value", TRANSIENT_VALUE), optional("type", TYPE_STRING)}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).addClaimElement},
+	{Name: "removeClaimElement", Params: []Param{str("idClient"), str("claimName"), str("elementId")}, Submit: true, Handler: (*SmartContract).removeClaimElement},
+	{Name: "removeUser", Params: []Param{str("idClient")}, Submit: true, Handler: (*SmartContract).removeUser},
+	{Name: "getUserById", Params: []Param{str("idClient")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).getUserById},
+	{Name: "queryClaimsById", Params: []Param{str("idClient")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryClaimsById},
+	{Name: "queryDocConflicts", Params: []Param{optional("idClient", TYPE_STRING)}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryDocConflicts},
+	{Name: "resolveDocConflict", Params: []Param{str("idClient"), str("conflictId"), str("idAttester"), str("decision")}, Submit: true, Handler: (*SmartContract).resolveDocConflict},
+	{Name: "setDocIndexKey", Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).setDocIndexKey},
+	{Name: "indexDocIDs", Params: []Param{str("startKey"), typed("limit", TYPE_INTEGER)}, Returns: TYPE_OBJECT, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).indexDocIDs},
+	{Name: "linkIdentities", Params: []Param{str("idClient"), str("other")}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).linkIdentities},
+	{Name: "queryLinkedIdentities", Params: []Param{str("idClient")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryLinkedIdentities},
+	{Name: "mergeIdentities", Params: []Param{str("survivor"), str("merged")}, Submit: true, Handler: (*SmartContract).mergeIdentities},
+	{Name: "setOwnerSecret", Params: []Param{str("idClient"), str("secretHash")}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).setOwnerSecret},
+	{Name: "requestAttestation", Params: []Param{str("idAttester"), str("idClient"), str("claimName"), str("claimUrl")}, Submit: true, Handler: (*SmartContract).requestAttestation},
+	{Name: "createAttestation", Aliases: []string{"createAttestion"}, Params: []Param{str("idAttester"), str("idClient"), str("claimName"), str("hashClaim")}, Submit: true, Handler: (*SmartContract).createAttestation},
+	{Name: "rejectAttestation", Params: []Param{str("idAttester"), str("idClient"), str("claimName")}, Submit: true, Handler: (*SmartContract).rejectAttestation},
+	{Name: "revokeAttestation", Params: []Param{str("idAttester"), str("idClient"), str("claimName")}, Submit: true, Handler: (*SmartContract).revokeAttestation},
+	{Name: "queryRequestAttestation", Params: []Param{str("idAttester")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryRequestAttestation},
+	{Name: "queryAttestation", Params: []Param{str("idAttester")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryAttestation},
+	{Name: "queryAttesterStats", Params: []Param{str("idAttester")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryAttesterStats},
+	{Name: "attesterLeaderboard", Params: []Param{str("metric"), typed("limit", TYPE_INTEGER)}, Returns: TYPE_ARRAY, Handler: (*SmartContract).attesterLeaderboard},
+	{Name: "pruneAttesterStats", Params: []Param{str("idAttester")}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).pruneAttesterStats},
+	{Name: "isClaimVerified", Params: []Param{str("idClient"), str("claimName"), typed("attesters", TYPE_LIST), optional("root", TYPE_STRING)}, Returns: TYPE_OBJECT, Handler: (*SmartContract).isClaimVerified},
+	{Name: "registerParty", Params: []Param{str("party"), str("org"), optional("controller", TYPE_OBJECT)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).registerParty},
+	{Name: "queryParty", Params: []Param{str("party")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryParty},
+	{Name: "registerTrustRoot", Params: []Param{str("root"), str("name")}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).registerTrustRoot},
+	{Name: "accreditAttester", Params: []Param{str("accreditor"), str("idAttester"), typed("claims", TYPE_LIST), typed("maxDepth", TYPE_INTEGER), typed("validDays", TYPE_INTEGER)}, Submit: true, Handler: (*SmartContract).accreditAttester},
+	{Name: "revokeAccreditation", Params: []Param{str("idAttester"), str("claimName")}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).revokeAccreditation},
+	{Name: "queryAccreditations", Params: []Param{str("idAttester")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryAccreditations},
+	{Name: "trustChain", Params: []Param{str("idAttester"), str("idClient"), str("claimName"), str("root")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).trustChain},
+	{Name: "shareinfo", Aliases: []string{"shareInfo"}, Params: []Param{str("idClient"), str("relyingParty"), str("claimName"), sealed("token", TRANSIENT_TOKEN), optional("validDays", TYPE_INTEGER), optional("purpose", TYPE_STRING), optional("jurisdiction", TYPE_STRING), optional("singleUse", TYPE_BOOLEAN)}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).shareinfo},
+	{Name: "redeemShareToken", Params: []Param{str("idClient"), str("relyingParty"), str("claimName"), sealed("token", TRANSIENT_TOKEN)}, Returns: TYPE_OBJECT, Submit: true, Handler: (*SmartContract).redeemShareToken},
+	{Name: "accessSharedClaim", Params: []Param{str("idClient"), str("relyingParty"), sealed("token", TRANSIENT_TOKEN), optional("claims", TYPE_LIST)}, Returns: TYPE_OBJECT, Submit: true, Handler: (*SmartContract).accessSharedClaim},
+	{Name: "queryAccessLog", Params: []Param{str("idClient"), optional("relyingParty", TYPE_STRING)}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryAccessLog},
+	{Name: "resolvePseudonym", Params: []Param{str("pseudonym"), str("relyingParty")}, Returns: TYPE_STRING, Handler: (*SmartContract).resolvePseudonym},
+	{Name: "requestConsent", Params: []Param{str("idClient"), str("relyingParty"), typed("claims", TYPE_LIST), str("purpose"), optional("validDays", TYPE_INTEGER), optional("jurisdiction", TYPE_STRING)}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).requestConsent},
+	{Name: "queryConsentRequests", Params: []Param{str("idClient")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryConsentRequests},
+	{Name: "approveConsent", Params: []Param{str("idClient"), str("requestId"), sealed("token", TRANSIENT_TOKEN)}, Returns: TYPE_STRING, Submit: true, Handler: (*SmartContract).approveConsent},
+	{Name: "declineConsent", Params: []Param{str("idClient"), str("requestId")}, Submit: true, Handler: (*SmartContract).declineConsent},
+	{Name: "queryConsentReceipt", Params: []Param{str("receiptId")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryConsentReceipt},
+	{Name: "queryReceiptsByUser", Params: []Param{str("idClient")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryReceiptsByUser},
+	{Name: "queryReceiptsByRelyingParty", Params: []Param{str("relyingParty")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryReceiptsByRelyingParty},
+	{Name: "setRateLimit", Params: []Param{str("idAttester"), typed("maxRequests", TYPE_INTEGER), typed("window", TYPE_INTEGER), typed("cooldown", TYPE_INTEGER), typed("deposit", TYPE_INTEGER)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).setRateLimit},
+	{Name: "queryRateLimit", Params: []Param{str("idAttester")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryRateLimit},
+	{Name: "creditDeposit", Params: []Param{str("requester"), typed("amount", TYPE_INTEGER)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).creditDeposit},
+	{Name: "queryDeposit", Returns: TYPE_OBJECT, Handler: (*SmartContract).queryDeposit},
+	{Name: "setBillingRate", Params: []Param{str("kind"), typed("unitPrice", TYPE_INTEGER)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).setBillingRate},
+	{Name: "closeBillingPeriod", Params: []Param{str("period")}, Returns: TYPE_OBJECT, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).closeBillingPeriod},
+	{Name: "queryInvoice", Params: []Param{str("party"), str("period")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryInvoice},
+	{Name: "queryInvoices", Params: []Param{str("party")}, Returns: TYPE_ARRAY, Handler: (*SmartContract).queryInvoices},
+	{Name: "disputeInvoice", Params: []Param{str("party"), str("period"), str("reason")}, Submit: true, Handler: (*SmartContract).disputeInvoice},
+	{Name: "resolveInvoiceDispute", Params: []Param{str("party"), str("period"), str("resolution")}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).resolveInvoiceDispute},
+	{Name: "registerClaimSchema", Params: []Param{str("claimName"), str("pattern"), str("jsonSchema"), str("sensitivity"), typed("attesters", TYPE_LIST), typed("validDays", TYPE_INTEGER)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).registerClaimSchema},
+	{Name: "queryClaimSchema", Params: []Param{str("claimName")}, Returns: TYPE_OBJECT, Handler: (*SmartContract).queryClaimSchema},
+	{Name: "queryClaimSchemas", Returns: TYPE_ARRAY, Handler: (*SmartContract).queryClaimSchemas},
+	{Name: "importIdentities", Params: []Param{secret("records", TRANSIENT_RECORDS)}, Returns: TYPE_ARRAY, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).importIdentities},
+	{Name: "exportIdentities", Params: []Param{typed("pageSize", TYPE_INTEGER), optional("bookmark", TYPE_STRING)}, Returns: TYPE_OBJECT, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).exportIdentities},
+	{Name: "migrateBatch", Params: []Param{typed("batchSize", TYPE_INTEGER)}, Returns: TYPE_OBJECT, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).migrateBatch},
+	{Name: "queryKeyPolicy", Params: []Param{str("key")}, Returns: TYPE_OBJECT, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).queryKeyPolicy},
+	{Name: "setKeyPolicy", Params: []Param{str("key"), typed("orgs", TYPE_LIST)}, Submit: true, Roles: []string{GOVERNANCE}, Handler: (*SmartContract).setKeyPolicy},
+}
+
+// signatures are the parameters of the transactions by name, filled by init so that handlers can
+// use the routing table without an initialization cycle
+var signatures = map[string][]Param{}
+
+func init() {
+	for _, tx := range transactions {
+		signatures[tx.Name] = tx.Params
+	}
+}
+
+/*
+ * checkArgs checks the number of arguments a handler got, once the values sent in the transient
+ * map are in place, against the parameters of its transaction
+ */
+func checkArgs(name string, args []string) error {
+	params := signatures[name]
+	required := 0
+	for _, param := range params {
+		if !param.Optional {
+			required++
+		}
+	}
+	if len(args) >= required && len(args) <= len(params) {
+		return nil
+	}
+	switch len(params) - required {
+	case 0:
+		return fmt.Errorf("Incorrect number of arguments. Expecting %d", required)
+	case 1:
+		return fmt.Errorf("Incorrect number of arguments. Expecting %d or %d", required, len(params))
+	}
+	return fmt.Errorf("Incorrect number of arguments. Expecting %d to %d", required, len(params))
+}
+
+func transactionByName(name string) (Transaction, bool) {
+	for _, tx := range transactions {
+		if tx.Name == name {
+			return tx, true
+		}
+		for _, alias := range tx.Aliases {
+			if alias == name {
+				return tx, true
+			}
+		}
+	}
+	return Transaction{}, false
+}
+
+/*
+ * validateArgs checks the positional args of a call against the signature of tx. Parameters that
+ * the transient map carries are not expected in args.
+ */
+func validateArgs(APIstub shim.ChaincodeStubInterface, tx Transaction, args []string) error {
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return err
+	}
+	params := []Param{}
+	for _, param := range tx.Params {
+		if _, ok := transient[param.Transient]; ok && param.Transient != "" {
+			continue
+		}
+		if param.Sealed {
+			return sealedError(tx, param)
+		}
+		params = append(params, param)
+	}
+	if len(args) > len(params) {
+		return fmt.Errorf("Incorrect number of arguments for %s. Expecting at most %d", tx.Name, len(params))
+	}
+	for i, param := range params {
+		if i >= len(args) {
+			if !param.Optional && param.Transient == "" {
+				return fmt.Errorf("Incorrect number of arguments for %s. Missing %s", tx.Name, param.Name)
+			}
+			continue
+		}
+		if args[i] == "" && param.Optional {
+			continue
+		}
+		switch param.Type {
+		case TYPE_INTEGER:
+			if _, err := strconv.ParseInt(args[i], 10, 64); err != nil {
+				return fmt.Errorf("Argument %s of %s must be an integer", param.Name, tx.Name)
+			}
+		case TYPE_BOOLEAN:
+			if _, err := strconv.ParseBool(args[i]); err != nil {
+				return fmt.Errorf("Argument %s of %s must be true or false", param.Name, tx.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// sealedError rejects a sealed parameter that was not sent in the transient map
+func sealedError(tx Transaction, param Param) error {
+	return fmt.Errorf("Argument %s of %s must be sent in the transient map as %s", param.Name, tx.Name, param.Transient)
+}
+
+// FunctionDescription is a routing table entry as returned by describe
+type FunctionDescription struct {
+	Name     string           `json:"name"`
+	Aliases  []string         `json:"aliases,omitempty"`
+	ReadOnly bool             `json:"readOnly"`
+	Args     []ArgDescription `json:"args"`
+	Roles    []string         `json:"roles,omitempty"`
+	Returns  string           `json:"returns,omitempty"`
+}
+
+type ArgDescription struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Optional  bool   `json:"optional,omitempty"`
+	Transient string `json:"transient,omitempty"`
+	Sealed    bool   `json:"sealed,omitempty"`
+}
+
+func describeTransaction(tx Transaction) FunctionDescription {
+	description := FunctionDescription{Name: tx.Name, Aliases: tx.Aliases, ReadOnly: !tx.Submit, Args: []ArgDescription{}, Roles: tx.Roles, Returns: tx.Returns}
+	for _, param := range tx.Params {
+		description.Args = append(description.Args, ArgDescription{Name: param.Name, Type: param.Type, Optional: param.Optional, Transient: param.Transient, Sealed: param.Sealed})
+	}
+	return description
+}
+
+/*
+ * DESCRIBE, the routing table: for every function its args in order, whether it is read only and
+ * the roles allowed to call it
+ * args: 0 => (function name, optional, all functions when left out)
+ */
+func (s *SmartContract) describe(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	var result interface{}
+	if len(args) == 1 {
+		tx, ok := transactionByName(args[0])
+		if !ok {
+			return shim.Error(fmt.Sprintf("Function %s not Found!", args[0]))
+		}
+		result = describeTransaction(tx)
+	} else {
+		descriptions := []FunctionDescription{}
+		for _, tx := range transactions {
+			descriptions = append(descriptions, describeTransaction(tx))
+		}
+		result = descriptions
+	}
+	resultAsBytes, _ := json.Marshal(result)
+	return shim.Success(resultAsBytes)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func mustTransaction(t *testing.T, name string) Transaction {
+	t.Helper()
+	tx, ok := transactionByName(name)
+	if !ok {
+		t.Fatalf("%s is not in the routing table", name)
+	}
+	return tx
+}
+
+func TestValidateArgs(t *testing.T) {
+	stub := &testStub{MockStub: shim.NewMockStub("identity", new(SmartContract)), t: t}
+	cases := []struct {
+		name      string
+		tx        string
+		transient []string
+		args      []string
+		err       string
+	}{
+		{"token in the transient map", "shareinfo", []string{TRANSIENT_TOKEN, "t"}, []string{"u", "rp", "c", "5", "p", "j", "true"}, ""},
+		{"positional token", "shareinfo", nil, []string{"u", "rp", "c", "t"}, "token of shareinfo must be sent in the transient map as token"},
+		{"token twice", "shareinfo", []string{TRANSIENT_TOKEN, "t"}, []string{"u", "rp", "c", "t", "5", "p", "j", "true"}, "Expecting at most 7"},
+		{"empty optional", "shareinfo", []string{TRANSIENT_TOKEN, "t"}, []string{"u", "rp", "c", ""}, ""},
+		{"integer", "shareinfo", []string{TRANSIENT_TOKEN, "t"}, []string{"u", "rp", "c", "five"}, "validDays of shareinfo must be an integer"},
+		{"boolean", "shareinfo", []string{TRANSIENT_TOKEN, "t"}, []string{"u", "rp", "c", "", "", "", "maybe"}, "singleUse of shareinfo must be true or false"},
+		{"missing", "linkIdentities", nil, []string{"a"}, "Missing other"},
+		{"missing transient", "createId", nil, []string{}, ""},
+	}
+	for _, c := range cases {
+		stub.with(c.transient...)
+		err := validateArgs(stub, mustTransaction(t, c.tx), c.args)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	cases := []struct {
+		tx   string
+		args int
+		err  string
+	}{
+		{"linkIdentities", 2, ""},
+		{"linkIdentities", 3, "Expecting 2"},
+		{"registerParty", 3, ""},
+		{"registerParty", 1, "Expecting 2 or 3"},
+		{"shareinfo", 4, ""},
+		{"shareinfo", 9, "Expecting 4 to 8"},
+		{"setDocIndexKey", 1, "Expecting 0"},
+	}
+	for _, c := range cases {
+		err := checkArgs(c.tx, make([]string, c.args))
+		if c.err == "" && err != nil {
+			t.Errorf("%s with %d args: %s", c.tx, c.args, err.Error())
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s with %d args: got error %v, want %q", c.tx, c.args, err, c.err)
+		}
+	}
+}
+
+func TestInvokeRoles(t *testing.T) {
+	stub := newTestStub(t)
+	if message := stub.mustFail("registerParty", "rp", TEST_ORG); !strings.Contains(message, "Only governance admins") {
+		t.Errorf("a client without role registered a party: %s", message)
+	}
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "rp", TEST_ORG)
+	if message := stub.mustFail("unknownFunction"); message != "Invalid Smart Contract function name." {
+		t.Errorf("unexpected error %s", message)
+	}
+}
+
+func TestDescribeAndAliases(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url")
+	stub.mustInvoke("createAttestion", "acme", "alice", "fullname", "hash")
+
+	description := FunctionDescription{}
+	if err := json.Unmarshal(stub.mustInvoke("describe", "createAttestion"), &description); err != nil {
+		t.Fatal(err)
+	}
+	if description.Name != "createAttestation" || description.ReadOnly || len(description.Args) != 4 {
+		t.Errorf("unexpected description %+v", description)
+	}
+	if err := json.Unmarshal(stub.mustInvoke("describe", "registerParty"), &description); err != nil {
+		t.Fatal(err)
+	}
+	if len(description.Roles) != 1 || description.Roles[0] != GOVERNANCE || !description.Args[2].Optional {
+		t.Errorf("unexpected description %+v", description)
+	}
+	stub.mustFail("describe", "unknownFunction")
+}
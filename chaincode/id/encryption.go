@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+ * Encrypted claims: when the transient map carries an AES-256 key ("claimKey"), claim values
+ * are AES-GCM encrypted inside the chaincode before they are written, so world state and blocks
+ * only hold ciphertext. The value itself then has to be sent in the transient map too.
+ * queryClaimsById decrypts the values when it gets the same key.
+ */
+
+// Transient map keys of the encrypted claims mode
+const (
+	TRANSIENT_CLAIM_KEY = "claimKey"
+	TRANSIENT_VALUE     = "value"
+)
+
+// ENCRYPTED is the prefix of encrypted claim values
+const ENCRYPTED = "aesgcm:"
+
+// transientClaimKey returns the claim encryption key of the transaction, nil when none was given
+func transientClaimKey(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := transient[TRANSIENT_CLAIM_KEY]
+	if !ok {
+		return nil, nil
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("The claim key must be a 32 bytes AES-256 key")
+	}
+	return key, nil
+}
+
+// requirePrivateValues refuses to encrypt values that were sent in the clear in the positional args
+func requirePrivateValues(APIstub shim.ChaincodeStubInterface, private bool) error {
+	key, err := transientClaimKey(APIstub)
+	if err != nil {
+		return err
+	}
+	if key != nil && !private {
+		return fmt.Errorf("Encrypted claim values must be sent in the transient map")
+	}
+	return nil
+}
+
+/*
+ * sealClaim returns the value to store for a claim of user: encrypted when the transaction
+ * carries a claim key, the value itself otherwise
+ */
+func sealClaim(APIstub shim.ChaincodeStubInterface, user string, claim string, value string) (string, error) {
+	key, err := transientClaimKey(APIstub)
+	if err != nil || key == nil {
+		return value, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	// every endorser has to produce the same ciphertext, the nonce is derived instead of random
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(APIstub.GetTxID() + "\x00" + user + "\x00" + claim))
+	nonce := mac.Sum(nil)[:gcm.NonceSize()]
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), claimAAD(user, claim))
+	return ENCRYPTED + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openClaim decrypts a value stored by sealClaim, values that are not encrypted are returned as they are
+func openClaim(key []byte, user string, claim string, value string) (string, error) {
+	if !strings.HasPrefix(value, ENCRYPTED) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, ENCRYPTED))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("Encrypted claim %s is too short", claim)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], claimAAD(user, claim))
+	if err != nil {
+		return "", fmt.Errorf("Cannot decrypt claim %s: %s", claim, err.Error())
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// the ciphertext is bound to its user and claim, so it can not be copied to another one
+func claimAAD(user string, claim string) []byte {
+	return []byte(user + "\x00" + claim)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func queryClaims(t *testing.T, stub *testStub, user string, pairs ...string) map[string]Claim {
+	t.Helper()
+	stub.with(pairs...)
+	result := struct {
+		Claims map[string]Claim `json:"claims"`
+	}{}
+	if err := json.Unmarshal(stub.mustInvoke("queryClaimsById", user), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Claims
+}
+
+func TestEncryptedClaim(t *testing.T) {
+	stub := newTestStub(t)
+	key := strings.Repeat("c", 32)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "email", ".+@.+", "", SENSITIVITY_MEDIUM, "", "30")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+
+	stub.with(TRANSIENT_CLAIM_KEY, key)
+	if message := stub.mustFail("addClaim", "alice", "email", "alice@example.com"); message != "Encrypted claim values must be sent in the transient map" {
+		t.Errorf("a value sent in the clear was encrypted: %s", message)
+	}
+	stub.with(TRANSIENT_CLAIM_KEY, "short", TRANSIENT_VALUE, "alice@example.com")
+	stub.mustFail("addClaim", "alice", "email")
+	stub.with(TRANSIENT_CLAIM_KEY, key, TRANSIENT_VALUE, "alice@example.com")
+	stub.mustInvoke("addClaim", "alice", "email")
+
+	stored := stub.getID("alice").Claims["email"].Value
+	if !strings.HasPrefix(stored, ENCRYPTED) || strings.Contains(string(stub.State["alice"]), "alice@example.com") {
+		t.Errorf("world state holds the value in the clear: %s", stored)
+	}
+	if value := queryClaims(t, stub, "alice")["email"].Value; value != stored {
+		t.Errorf("the claim was decrypted without the key: %s", value)
+	}
+	if value := queryClaims(t, stub, "alice", TRANSIENT_CLAIM_KEY, key)["email"].Value; value != "alice@example.com" {
+		t.Errorf("unexpected value %s", value)
+	}
+	stub.with(TRANSIENT_CLAIM_KEY, strings.Repeat("d", 32))
+	stub.mustFail("queryClaimsById", "alice")
+
+	// the ciphertext is bound to the user and the claim
+	if _, err := openClaim([]byte(key), "bob", "email", stored); err == nil {
+		t.Errorf("the claim of alice was decrypted as a claim of bob")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Key level endorsement: once an ID is created it can only be changed by transactions endorsed
+ * by peers of the org that created it, and an attester_<id> bucket only by peers of the org the
+ * attester is registered with (see registerParty). This overrides the chaincode level endorsement
+ * policy for those keys.
+ */
+
+/*
+ * ensureKeyPolicy restricts key to the peers of the transaction creator's org, unless key
+ * already has its own endorsement policy
+ */
+func ensureKeyPolicy(APIstub shim.ChaincodeStubInterface, key string) error {
+	policy, err := APIstub.GetStateValidationParameter(key)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		return nil
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return err
+	}
+	return setKeyOrgs(APIstub, key, []string{org})
+}
+
+/*
+ * ensureAttesterPolicy restricts the attester_<id> bucket to the peers of the org the attester is
+ * registered with, unless the bucket already has its own endorsement policy
+ */
+func ensureAttesterPolicy(APIstub shim.ChaincodeStubInterface, attester string) error {
+	party, err := getParty(APIstub, attester)
+	if err != nil {
+		return err
+	}
+	policy, err := APIstub.GetStateValidationParameter(ATTEST + attester)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		return nil
+	}
+	return setKeyOrgs(APIstub, ATTEST+attester, []string{party.Org})
+}
+
+/*
+ * requireIDOrg checks the caller is a client of an org whose peers endorse the ID of the user.
+ * IDs created before key level endorsement have no policy of their own, any org can change them.
+ */
+func requireIDOrg(APIstub shim.ChaincodeStubInterface, user string) error {
+	if _, err := getID(APIstub, user); err != nil {
+		return err
+	}
+	orgs, err := keyOrgs(APIstub, user)
+	if err != nil || len(orgs) == 0 {
+		return err
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return err
+	}
+	for _, owner := range orgs {
+		if owner == org {
+			return nil
+		}
+	}
+	return fmt.Errorf("Only clients of %s can act for %s", strings.Join(orgs, ", "), user)
+}
+
+// setKeyOrgs requires the endorsement of a peer of each of orgs to change key
+func setKeyOrgs(APIstub shim.ChaincodeStubInterface, key string, orgs []string) error {
+	ep, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	if err := ep.AddOrgs(statebased.RoleTypePeer, orgs...); err != nil {
+		return err
+	}
+	policy, err := ep.Policy()
+	if err != nil {
+		return err
+	}
+	return APIstub.SetStateValidationParameter(key, policy)
+}
+
+// keyOrgs lists the orgs whose peers must endorse changes of key, empty when key has no policy
+func keyOrgs(APIstub shim.ChaincodeStubInterface, key string) ([]string, error) {
+	policy, err := APIstub.GetStateValidationParameter(key)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return []string{}, nil
+	}
+	ep, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, err
+	}
+	return ep.ListOrgs(), nil
+}
+
+/*
+ * QUERY KEY ENDORSEMENT POLICY (governance admins only)
+ * args: 0 => (key, user key or attester_<id>)
+ */
+func (s *SmartContract) queryKeyPolicy(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryKeyPolicy", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	orgs, err := keyOrgs(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	orgsAsBytes, _ := json.Marshal(map[string]interface{}{"key": args[0], "orgs": orgs})
+	return shim.Success(orgsAsBytes)
+}
+
+/*
+ * SET KEY ENDORSEMENT POLICY (governance admins only), a peer of every org must endorse changes of the key
+ * args: 0 => (key, user key or attester_<id>), 1 => (MSP ids, comma separated)
+ */
+func (s *SmartContract) setKeyPolicy(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("setKeyPolicy", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	valueAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if valueAsBytes == nil {
+		return shim.Error(fmt.Sprintf("Key %s not Found!", args[0]))
+	}
+	orgs := splitList(args[1])
+	if len(orgs) == 0 {
+		return shim.Error("At least one org is required")
+	}
+
+	if err := setKeyOrgs(APIstub, args[0], orgs); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
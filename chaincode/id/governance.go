@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ROLE_ATTR is the certificate attribute (set when the user is registered with
+// the Fabric CA) that carries the caller's role in the identity network.
+const ROLE_ATTR = "id.role"
+
+// GOVERNANCE is the ROLE_ATTR value of governance admins.
+const GOVERNANCE = "governance"
+
+/*
+ * check that the creator of the transaction has one of roles
+ */
+func requireRole(APIstub shim.ChaincodeStubInterface, roles ...string) error {
+	role, found, err := cid.GetAttributeValue(APIstub, ROLE_ATTR)
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, allowed := range roles {
+			if role == allowed {
+				return nil
+			}
+		}
+	}
+	if len(roles) == 1 && roles[0] == GOVERNANCE {
+		return fmt.Errorf("Only governance admins can call this function")
+	}
+	return fmt.Errorf("Only callers with role %s can call this function", strings.Join(roles, " or "))
+}
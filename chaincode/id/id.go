@@ -30,10 +30,10 @@ package main
  */
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"strconv"
-	"crypto/rand"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
@@ -43,18 +43,52 @@ import (
 type SmartContract struct {
 }
 
-type AttestClaim struct{
- Claim map[string]map[string]string `json:"claim"`
+type AttestClaim struct {
+	Version int                          `json:"version"`
+	Claim   map[string]map[string]string `json:"claim"`
 }
 
 type Credential struct {
-   Token    string `json:"token"`
-   ValidDay int `json:"validDay"`
+	TokenHash string `json:"tokenHash"`
+	Salt      string `json:"salt"`
+	ValidDay  int    `json:"validDay"`
+	Granted   int64  `json:"granted,omitempty"`
+	// Pseudonymous shares are accessed with the pairwise pseudonym of the relying party only,
+	// the pseudonym itself is kept in the private data collection
+	Pseudonymous bool  `json:"pseudonymous,omitempty"`
+	SingleUse    bool  `json:"singleUse,omitempty"`
+	Redeemed     int64 `json:"redeemed,omitempty"`
+}
+
+// DAY is the length of a day of validity in seconds
+const DAY = 24 * 60 * 60
+
+// expired reports whether the credential is no longer valid at now, credentials granted
+// before the grant time was recorded never expire
+func (c Credential) expired(now int64) bool {
+	return c.Granted != 0 && now >= c.Granted+int64(c.ValidDay)*DAY
+}
+
+// Claim is the value of a claim with where it comes from, see claim.go
+type Claim struct {
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	SetBy       string `json:"setBy,omitempty"`
+	Created     int64  `json:"created"`
+	Updated     int64  `json:"updated"`
+	TxID        string `json:"txId"`
+	Attestation string `json:"attestation,omitempty"`
+	// Type of the value, a string when empty, and the elements of array values, see typed.go
+	Type     string         `json:"type,omitempty"`
+	Elements []ClaimElement `json:"elements,omitempty"`
 }
 
 type ID struct {
-    Claims       map[string]string `json:"claims"`
-    Infoshared   map[string]map[string]Credential `json:"infoshared"`
+	Version    int                              `json:"version"`
+	Claims     map[string]Claim                 `json:"claims"`
+	Infoshared map[string]map[string]Credential `json:"infoshared"`
+	SecretHash string                           `json:"secretHash,omitempty"`
+	RedirectTo string                           `json:"redirectTo,omitempty"`
 }
 
 const REQUEST = "requestAttest_"
@@ -65,6 +99,22 @@ const ATTEST = "attester_"
  * Best practice is to have any Ledger initialization in separate function -- see initLedger()
  */
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
+	// register the default claim types used by createId
+	if err := seedClaimSchemas(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	// earlier versions salted the docid index in world state, see setDocIndexKey
+	if err := dropPublicDocIndex(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	// and mapped pseudonyms to their users in world state too
+	if err := movePublicPseudonyms(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	// on upgrade bring existing records to the current version, large ledgers continue with migrateBatch
+	if _, err := migrateLedger(APIstub, MIGRATION_BATCH); err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -77,70 +127,115 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response
 	// Retrieve the requested Smart Contract function and arguments
 	function, args := APIstub.GetFunctionAndParameters()
 	// Route to the appropriate handler function to interact with the ledger appropriately
-	if function == "queryClaimsById" {
-		return s.queryClaimsById(APIstub, args)
-	} else if function == "createId" {
-		return s.createId(APIstub, args)
-	} else if function == "addClaim" {
-		return s.addClaim(APIstub, args)
-	} else if function == "requestAttestation" {
-		return s.requestAttestation(APIstub, args)
-	} else if function == "createAttestion" {
-		return s.createAttestion(APIstub, args)
-	} else if function == "shareinfo" {
-		return s.shareinfo(APIstub, args)
-	} else if function == "queryRequestAttestation" {
-		return s.queryRequestAttestation(APIstub, args)
-	} else if function == "queryAttestation" {
-		return s.queryAttestation(APIstub, args)
-	} else if function == "removeUser" {
-		return s.removeUser(APIstub, args)
-	} else if function == "initLedger" {
-		return s.initLedger(APIstub)
-	} else if function == "getUserById"{
-		return s.getUserById(APIstub, args)
-	}
-
-	return shim.Error("Invalid Smart Contract function name.")
+	if function == DESCRIBE {
+		return s.describe(APIstub, args)
+	}
+	tx, ok := transactionByName(function)
+	if !ok {
+		return shim.Error("Invalid Smart Contract function name.")
+	}
+	if err := validateArgs(APIstub, tx, args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(tx.Roles) > 0 {
+		if err := requireRole(APIstub, tx.Roles...); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return tx.Handler(s, APIstub, args)
 }
 
 /*
- * SHAREINFORMATION
- * args: 0 => (idClient), 1 => (attester), 2 => (ClaimName), 3 => (token), 4 => (validDays)
+ * SHAREINFORMATION, returns the id of the consent receipt. When the user's pseudonym secret is
+ * given in the transient map the relying party only learns its pairwise pseudonym of the user.
+ * The receipt names the controller details the relying party was registered with, if any.
+ * The token is generated by the client, only its salted hash is stored.
+ * args: 0 => (idClient), 1 => (attester), 2 => (ClaimName), 3 => (token, transient map only),
+ *       optional 4 => (validDays, the default of the claim schema when empty), 5 => (purpose),
+ *       6 => (jurisdiction), 7 => (singleUse "true"|"false")
+ * The token is only accepted in the transient map ("token"), it is spliced in as args[3].
  */
 func (s *SmartContract) shareinfo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 5 {
-	   return shim.Error("Incorrect number of arguments. Expecting 5")
-  }
+	args, err := transientArgs(APIstub, args, 3, TRANSIENT_TOKEN)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkArgs("shareinfo", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	purpose, jurisdiction := optionalArg(args, 5), optionalArg(args, 6)
+	singleUse := false
+	if optionalArg(args, 7) != "" {
+		if singleUse, err = strconv.ParseBool(args[7]); err != nil {
+			return shim.Error("singleUse must be true or false")
+		}
+	}
 
-	//get state of AttesterRequest and validate if existe user or not
-  idAsBytes, ok := APIstub.GetState(args[0])
+	//get state of the user and validate if exist or not
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the default of the claim schema when validDays is empty
+	validDays, err := shareValidDays(APIstub, optionalArg(args, 4), []string{args[2]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	pseudonym, err := sharePseudonym(APIstub, args[0], id, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	credential := Credential{ValidDay: validDays, Pseudonymous: pseudonym != "", SingleUse: singleUse}
+	if err := grantShare(APIstub, &id, args[1], args[2], args[3], credential); err != nil {
+		return shim.Error(err.Error())
+	}
+	// save state
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+	receipt, err := issueConsentReceipt(APIstub, args[0], pseudonym, args[1], []string{args[2]}, purpose, validDays, jurisdiction, "shareinfo")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
-	if ok == nil {
-		id := ID{}
-	  json.Unmarshal(idAsBytes, &id)
-    // if not exist then create the object
-		if id.Infoshared == nil {
-			id.Infoshared = make(map[string]map[string]Credential)
-		}
-    // if not exist then create the object key
-		_, ok2 := id.Infoshared[args[1]]
-		if !ok2 {
-			id.Infoshared[args[1]] = make(map[string]Credential)
-		}
-    // parse to integer the validDays
-    validDays, _ := strconv.Atoi(args[4])
-		id.Infoshared[args[1]][args[2]] = Credential {Token: args[3], ValidDay: validDays}
-    //parse to bytes and save state
-		idAsBytes, _ := json.Marshal(id)
-		APIstub.PutState(args[0], idAsBytes)
+	return shim.Success([]byte(receipt.ConsentReceiptID))
+}
 
-		return shim.Success(nil)
-	} else {
-		return shim.Error("User Not Found!")
+/*
+ * sharePseudonym returns the pairwise pseudonym relyingParty gets for the user when the
+ * transaction carries the user's secret, an empty string otherwise
+ */
+func sharePseudonym(APIstub shim.ChaincodeStubInterface, user string, id ID, relyingParty string) (string, error) {
+	secret, err := transientSecret(APIstub)
+	if err != nil || secret == nil {
+		return "", err
 	}
+	return registerPseudonym(APIstub, user, id, relyingParty, secret)
+}
 
+/*
+ * grantShare gives relyingParty access to a claim of the user with the validity, pseudonym and
+ * single use settings of credential, callers save the ID afterwards.
+ * The pseudonym is the only identifier the relying party can access a pseudonymous share with.
+ */
+func grantShare(APIstub shim.ChaincodeStubInterface, id *ID, relyingParty string, claim string, token string, credential Credential) error {
+	if token == "" {
+		return fmt.Errorf("The share token must not be empty")
+	}
+	granted, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	credential.Granted = granted
+	credential.Salt = tokenSalt(APIstub.GetTxID(), relyingParty, claim)
+	credential.TokenHash = hashToken(credential.Salt, token)
+	// if not exist then create the object key
+	if _, ok := id.Infoshared[relyingParty]; !ok {
+		id.Infoshared[relyingParty] = make(map[string]Credential)
+	}
+	id.Infoshared[relyingParty][claim] = credential
+	return nil
 }
 
 /*
@@ -149,92 +244,186 @@ func (s *SmartContract) shareinfo(APIstub shim.ChaincodeStubInterface, args []st
  */
 func (s *SmartContract) queryAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-	  return shim.Error("Incorrect number of arguments. Expecting 1")
-  }
+	if err := checkArgs("queryAttestation", args); err != nil {
+		return shim.Error(err.Error())
+	}
 	// index of state all ATTESTATION
-  attestationsIndex  := ATTEST  + args[0]
-  // get the state
-	requestAsBytes, ok := APIstub.GetState(attestationsIndex)
-	if ok == nil {
-      requestObj := AttestClaim{Claim: make(map[string]map[string]string)}
-			json.Unmarshal(requestAsBytes, &requestObj)
-			if requestObj.Claim == nil {
-          badResult := []byte(`{"error": "There are not request Attestations"}`)
-					return shim.Success(badResult)
-			}
-			// buffer is a JSON array containing QueryResults
-			var buffer bytes.Buffer
-			i := 0
-			buffer.WriteString("[")
-			for user, _ := range requestObj.Claim {
-			   jsonData, _ := json.Marshal(requestObj.Claim[user])
-         jsonResp := "{\"user\": \"" +  user + "\", \"claims\":" + string(jsonData) + "}"
-				 buffer.WriteString(jsonResp)
-         if i < len(requestObj.Claim)-1 {
-					 buffer.WriteString(", ")
-				 }
-				 i++
-		  }
-			buffer.WriteString("]")
-			fmt.Printf("- queryAllCars:\n%s\n", buffer.String())
-
-			return shim.Success(buffer.Bytes())
-	} else {
-		 badResult := []byte(`{"error": "There are not request Attestations"}`)
-		 return shim.Success(badResult)
+	attestationsObj, err := getAttestClaim(APIstub, ATTEST+args[0])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	return listAttestClaims(attestationsObj)
 }
 
 /*
- * SAVE ATTESTATION
+ * list the users and claims of an attestation document as a JSON array
+ */
+func listAttestClaims(requestObj AttestClaim) sc.Response {
+	if len(requestObj.Claim) == 0 {
+		badResult := []byte(`{"error": "There are not request Attestations"}`)
+		return shim.Success(badResult)
+	}
+	// buffer is a JSON array containing QueryResults
+	var buffer bytes.Buffer
+	i := 0
+	buffer.WriteString("[")
+	for user := range requestObj.Claim {
+		jsonData, _ := json.Marshal(requestObj.Claim[user])
+		jsonUser, _ := json.Marshal(user)
+		jsonResp := "{\"user\": " + string(jsonUser) + ", \"claims\":" + string(jsonData) + "}"
+		buffer.WriteString(jsonResp)
+		if i < len(requestObj.Claim)-1 {
+			buffer.WriteString(", ")
+		}
+		i++
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
+/*
+ * SAVE ATTESTATION, only clients of the org an attester is registered with (registerParty) can attest
  * args: 0 => (idAttester), 1 => (idClient), 2 => (ClaimName), 3 => (hashClaim)
  */
-func (s *SmartContract) createAttestion(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
-	}
-  // index to save and search into state
-  attestationsIndex  := ATTEST  + args[0]
-	idAttesterRequest  := REQUEST + args[0]
-	//get state of AttesterRequest
-  requestAsBytes, ok := APIstub.GetState(idAttesterRequest)
-  requestObj := AttestClaim{Claim: make(map[string]map[string]string)}
-  //if exist key decode Json to Object
-	if ok == nil  {
-     json.Unmarshal(requestAsBytes, &requestObj)
-	}else {
+func (s *SmartContract) createAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("createAttestation", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, _, err := callerParty(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// index to save and search into state
+	attestationsIndex := ATTEST + args[0]
+	requested, err := attestRequested(APIstub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !requested {
 		return shim.Error("Request of Attestation not Found!")
 	}
-  // get state of attestations
-  attestationsAsBytes, ok2 := APIstub.GetState(attestationsIndex)
-  attestationsObj := AttestClaim{Claim: make(map[string]map[string]string)}
-  //if exist key decode Json to Object
-  if ok2 == nil  {
-		json.Unmarshal(attestationsAsBytes, &attestationsObj)
-	}
-  // if no exist then create the mapping
-	if attestationsObj.Claim == nil{
-		attestationsObj.Claim = make(map[string]map[string]string)
-	}
-	var exist bool
-  // valid if existe the Claim mapping
-	_, exist = attestationsObj.Claim[args[1]]
-	if !exist {
+	if err := requireNoDocConflict(APIstub, args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// get state of attestations
+	attestationsObj, err := getAttestClaim(APIstub, attestationsIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// valid if existe the Claim mapping
+	if _, exist := attestationsObj.Claim[args[1]]; !exist {
 		attestationsObj.Claim[args[1]] = make(map[string]string)
 	}
 	//set the hash of the attestation
 	attestationsObj.Claim[args[1]][args[2]] = args[3]
-  //remove the key of that attestation
-	delete(requestObj.Claim[args[1]], args[2])
-	requestAsBytesFinal, _ := json.Marshal(requestObj)
-	APIstub.PutState(idAttesterRequest, requestAsBytesFinal)
-  //save the new attestation
-	attestationsAsBytesFinal, _ := json.Marshal(attestationsObj)
-	APIstub.PutState(attestationsIndex, attestationsAsBytesFinal)
-
-  return shim.Success(nil)
+	//remove the request of that attestation
+	if err := removeAttestRequest(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	//save the new attestation
+	if err := putAttestClaim(APIstub, attestationsIndex, attestationsObj); err != nil {
+		return shim.Error(err.Error())
+	}
+	// only the peers of the attester's registered org can change its attestations
+	if err := ensureAttesterPolicy(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// keep the accreditation path the attester had for the claim
+	if err := recordAttestationPath(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := countEvent(APIstub, args[0], METRIC_ATTESTED); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := recordUsage(APIstub, args[0], USAGE_ATTESTATION, 1); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := endTurnaround(APIstub, args[0], args[1], args[2], true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := releaseDeposit(APIstub, args[0], args[1], args[2], true); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the attester becomes the source of the claim
+	if err := linkAttestation(APIstub, args[1], args[2], args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+/*
+ * REJECT ATTESTATION, the attester declines to attest a requested claim, as a client of its org
+ * args: 0 => (idAttester), 1 => (idClient), 2 => (ClaimName)
+ */
+func (s *SmartContract) rejectAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("rejectAttestation", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, _, err := callerParty(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	requested, err := attestRequested(APIstub, args[0], args[1], args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !requested {
+		return shim.Error("Request of Attestation not Found!")
+	}
+	if err := removeAttestRequest(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := countEvent(APIstub, args[0], METRIC_REJECTED); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := endTurnaround(APIstub, args[0], args[1], args[2], false); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := releaseDeposit(APIstub, args[0], args[1], args[2], false); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+/*
+ * REVOKE ATTESTATION, the attester withdraws an attestation it made, as a client of its org
+ * args: 0 => (idAttester), 1 => (idClient), 2 => (ClaimName)
+ */
+func (s *SmartContract) revokeAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("revokeAttestation", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, _, err := callerParty(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	attestationsIndex := ATTEST + args[0]
+	attestationsObj, err := getAttestClaim(APIstub, attestationsIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, exist := attestationsObj.Claim[args[1]][args[2]]; !exist {
+		return shim.Error("Attestation not Found!")
+	}
+	delete(attestationsObj.Claim[args[1]], args[2])
+	if err := putAttestClaim(APIstub, attestationsIndex, attestationsObj); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the accreditation path only applies to an existing attestation
+	if err := clearAttestationPath(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := countEvent(APIstub, args[0], METRIC_REVOKED); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := unlinkAttestation(APIstub, args[1], args[2], args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
 }
 
 /*
@@ -243,76 +432,46 @@ func (s *SmartContract) createAttestion(APIstub shim.ChaincodeStubInterface, arg
  */
 func (s *SmartContract) queryRequestAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-	  return shim.Error("Incorrect number of arguments. Expecting 1")
-  }
-	// index of state REQUEST ATTESTATION
-  idAttesterRequest := REQUEST + args[0]
-  // get the state
-	requestAsBytes, ok := APIstub.GetState(idAttesterRequest)
-	if ok == nil{
-      requestObj := AttestClaim{Claim: make(map[string]map[string]string)}
-			json.Unmarshal(requestAsBytes, &requestObj)
-			if requestObj.Claim == nil {
-          badResult := []byte(`{"error": "There are not request Attestations"}`)
-					return shim.Success(badResult)
-			}
-			// buffer is a JSON array containing QueryResults
-			var buffer bytes.Buffer
-			i := 0
-			buffer.WriteString("[")
-			for user, _ := range requestObj.Claim {
-			   jsonData, _ := json.Marshal(requestObj.Claim[user])
-         jsonResp := "{\"user\": \"" +  user + "\", \"claims\":" + string(jsonData) + "}"
-				 buffer.WriteString(jsonResp)
-         if i < len(requestObj.Claim)-1 {
-					 buffer.WriteString(", ")
-				 }
-				 i++
-		  }
-			buffer.WriteString("]")
-			fmt.Printf("- queryAllCars:\n%s\n", buffer.String())
-
-			return shim.Success(buffer.Bytes())
-	} else {
-		 badResult := []byte(`{"error": "There are not request Attestations"}`)
-		 return shim.Success(badResult)
+	if err := checkArgs("queryRequestAttestation", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	requestObj, err := attestRequests(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	return listAttestClaims(requestObj)
 }
 
 /*
- * REQUEST ATTESTATION
+ * REQUEST ATTESTATION, by a client of the org whose peers endorse the ID of the user
  * args: 0 => (idAttester), 1 => (idClient), 2 => (ClaimName), 3 => (ClaimUrl)
  */
 func (s *SmartContract) requestAttestation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if err := checkArgs("requestAttestation", args); err != nil {
+		return shim.Error(err.Error())
 	}
-  // index to save and search into state
-  idAttesterRequest := REQUEST + args[0]
-	requestAsBytes, ok := APIstub.GetState(idAttesterRequest)
-  requestObj := AttestClaim{Claim: make(map[string]map[string]string)}
-
-	if ok  == nil {
-     json.Unmarshal(requestAsBytes, &requestObj)
-     if requestObj.Claim == nil{
-			 requestObj.Claim = make(map[string]map[string]string)
-		 }
-     var exist bool
-		 _, exist = requestObj.Claim[args[1]]
-		 if !exist {
-			 requestObj.Claim[args[1]] = make(map[string]string)
-		 }
-
-		 requestObj.Claim[args[1]][args[2]] = args[3]
-	}else{
-     requestObj.Claim[args[1]] = make(map[string]string)
-		 requestObj.Claim[args[1]][args[2]] = args[3]
+	if err := requireIDOrg(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// only registered claims can be attested, and only by allowed attesters
+	if err := validateAttestationRequest(APIstub, args[2], args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// quotas, cooldown and deposits of the attester
+	if err := limitAttestationRequest(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// one row per request, see request.go
+	if err := putAttestRequest(APIstub, args[0], args[1], args[2], args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := countEvent(APIstub, args[0], METRIC_REQUESTS); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := startTurnaround(APIstub, args[0], args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
 	}
-
-  requestAsBytesFinal, _ := json.Marshal(requestObj)
-	APIstub.PutState(idAttesterRequest, requestAsBytesFinal)
 
 	return shim.Success(nil)
 }
@@ -322,139 +481,267 @@ func (s *SmartContract) requestAttestation(APIstub shim.ChaincodeStubInterface,
  * Args: 0 => "userid or hashId"
  */
 func (s *SmartContract) removeUser(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
-	}
-  // search the user by id
-	_, ok := APIstub.GetState(args[0])
-  // if it's found then remove it else return error
-	if ok == nil {
-     APIstub.DelState(args[0])
-		 return shim.Error("User removed successfully!!!")
-	} else {
-     return shim.Error("User not exist! :(")
+	if err := checkArgs("removeUser", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	// search the user by id
+	if _, err := getID(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// if it's found then remove it
+	if err := APIstub.DelState(args[0]); err != nil {
+		return shim.Error(err.Error())
 	}
+	return shim.Success([]byte("User removed successfully!!!"))
 }
 
 /*
  * add Claim of User
- * Args: 0 => "userid or hashId", 1 => "key of claim", 2 => "value of Claim"
+ * Args: 0 => "userid or hashId", 1 => "key of claim", 2 => "value of Claim", optional 3 => "type of the value"
+ * The type is one of string (default), number, date, boolean, object or array.
+ * Replacing a claim with another value removes its attestation from the attester and replacing an
+ * array claim the attestations of its elements, the transaction then needs the endorsement of their
+ * orgs too. A claim set again to the value it has keeps its own attestation.
+ * To store the value encrypted send the key ("claimKey") and the value ("value") in the transient map
+ * and leave out args[2].
  */
 func (s *SmartContract) addClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	positional := len(args)
+	args, err := transientArgs(APIstub, args, 2, TRANSIENT_VALUE)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-
-	requestIdAsBytes, ok := APIstub.GetState(args[0])
-  // validate if user exist
-	if ok == nil {
-     id := ID{}
-     json.Unmarshal(requestIdAsBytes, &id)
-     id.Claims[args[1]]  = args[2]
-		 idAsBytes, _ := json.Marshal(id)
-	 	 APIstub.PutState(args[0], idAsBytes)
-
-	 	 return shim.Success(nil)
-	} else {
-		return shim.Error("User not exist!!!")
+	private := len(args) != positional
+	if err := checkArgs("addClaim", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	typ := optionalArg(args, 3)
+	if typ == "" {
+		typ = CLAIM_STRING
+	}
+	value, err := normalizeValue(typ, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	// the claim must be registered and conform to its schema
+	if err := validateClaim(APIstub, args[1], typ, value); err != nil {
+		return shim.Error(err.Error())
+	}
+	// validate if user exist
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requirePrivateValues(APIstub, private); err != nil {
+		return shim.Error(err.Error())
+	}
+	// document numbers are indexed, a number another identity holds opens a conflict
+	if args[1] == "docid" {
+		if typ != CLAIM_STRING {
+			return shim.Error("docid must be a string")
+		}
+		if _, err := changeDocID(APIstub, args[0], id.Claims["docid"].Value, value); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	// the elements replaced take their attestations with them
+	if err := dropElementAttestations(APIstub, args[0], args[1], id.Claims[args[1]].Elements); err != nil {
+		return shim.Error(err.Error())
+	}
+	var elements []ClaimElement
+	if typ == CLAIM_ARRAY {
+		if elements, err = newElements(APIstub, args[1], value); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	previous := id.Claims[args[1]]
+	if err := setTypedClaim(APIstub, &id, args[0], args[1], typ, value, elements); err != nil {
+		return shim.Error(err.Error())
+	}
+	// an attestation only holds for the value it was given for
+	if previous.Attestation != "" {
+		key, err := transientClaimKey(APIstub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		opened, err := openTypedClaim(key, args[0], args[1], previous)
+		if err == nil && claimType(opened) == typ && opened.Value == value {
+			claim := id.Claims[args[1]]
+			claim.Source, claim.Attestation = previous.Source, previous.Attestation
+			id.Claims[args[1]] = claim
+		} else if err := dropAttestation(APIstub, args[0], args[1], previous.Attestation); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
 	}
+
+	return shim.Success(nil)
 }
 
 /*
- *  create a User Identity
+ *  create a User Identity, returns the user key
  *  Args: 0 => "userid or hashId", 1 => "fullname", 2 => "docid"
+ *  or, to let the chaincode generate the user key: 0 => "fullname", 1 => "docid"
+ *  fullname and docid can be sent in the transient map ("fullname", "docid") instead of args.
+ *  They still end up in the ID record written to the ledger, unless they are encrypted with
+ *  a "claimKey" sent in the transient map too.
+ *  The owner's secret ("secret" in the transient map) is bound to the identity, it is the only
+ *  way to use pseudonyms and to link or merge the identity later on.
  */
 func (s *SmartContract) createId(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+	positional := len(args)
+	args, err := transientArgs(APIstub, args, len(args), TRANSIENT_FULLNAME, TRANSIENT_DOCID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	private := len(args) != positional
+	if err := checkArgs("createId", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(args) == 2 {
+		args = append([]string{deterministicID(APIstub, 0)}, args...)
+	} else if args[0] == "" {
+		args[0] = deterministicID(APIstub, 0)
 	}
 
-	_, exist := APIstub.GetState(args[0])
+	idAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if idAsBytes != nil {
+		return shim.Error("User already exist!!!")
+	}
+	if err := validateClaim(APIstub, "fullname", CLAIM_STRING, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateClaim(APIstub, "docid", CLAIM_STRING, args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	// a docid another identity holds opens a conflict, see queryDocConflicts
+	if _, err := indexDocID(APIstub, newDocBatch(), args[0], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	if exist != nil {
-		 return shim.Error("User already exist!!!")
+	if err := requirePrivateValues(APIstub, private); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	id := ID {Claims: make(map[string]string), Infoshared: make(map[string]map[string]Credential)}
-	id.Claims["fullname"] = args[1]
-  id.Claims["docid"]    = args[2]
+	id := ID{Claims: make(map[string]Claim), Infoshared: make(map[string]map[string]Credential)}
+	secret, err := transientSecret(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if secret != nil {
+		id.SecretHash = ownerSecretHash(args[0], secret)
+	}
+	for i, claim := range []string{"fullname", "docid"} {
+		value, err := sealClaim(APIstub, args[0], claim, args[i+1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := setClaim(APIstub, &id, claim, value); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 
-	idAsBytes, _ := json.Marshal(id)
-	APIstub.PutState(args[0], idAsBytes)
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+	// from now on only the peers of the creator's org can change the ID
+	if err := ensureKeyPolicy(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	return shim.Success(nil)
+	return shim.Success([]byte(args[0]))
 }
 
 /*
- * get User By Id
+ * get User By Id, the id of a merged identity gives its survivor
  * (0) => "iduser"
  */
 func (s *SmartContract) getUserById(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	if err := checkArgs("getUserById", args); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	idAsBytes, ok := APIstub.GetState(args[0])
-	if ok == nil {
-     return shim.Success(idAsBytes)
-	}else{
-			return shim.Error("User not exist! :(")
+	// merged identities redirect to their survivor
+	user, err := followRedirects(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
+	idAsBytes, _ := json.Marshal(id)
+	return shim.Success(idAsBytes)
 }
 
 /*
- * get Claims By Id
+ * get Claims By Id with their source, timestamps and attestation,
+ * encrypted claims are decrypted when the transient map carries their "claimKey"
  * (0) => "iduser"
  */
 func (s *SmartContract) queryClaimsById(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+	if err := checkArgs("queryClaimsById", args); err != nil {
+		return shim.Error(err.Error())
 	}
 
-  id := ID{}
-	idAsBytes, ok := APIstub.GetState(args[0])
-
-	if ok == nil {
-		  json.Unmarshal(idAsBytes, &id)
-			jsonData, _ := json.Marshal(id.Claims)
-      jsonResp := "{\"user\": \"" +  args[0] + "\", \"claims\":" + string(jsonData) + "}"
-
-			return shim.Success([]byte(jsonResp))
-	}else{
-      return shim.Error("User not exist! :(")
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := transientClaimKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if key != nil {
+		for name, claim := range id.Claims {
+			if id.Claims[name], err = openTypedClaim(key, args[0], name, claim); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
 	}
+	jsonData, _ := json.Marshal(id.Claims)
+	jsonUser, _ := json.Marshal(args[0])
+	jsonResp := "{\"user\": " + string(jsonUser) + ", \"claims\":" + string(jsonData) + "}"
+
+	return shim.Success([]byte(jsonResp))
 }
 
-func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface) sc.Response {
-  for i := 1; i < 10; i++ {
-		 u  := pseudo_uuid()
-     id := ID {Claims: map[string]string{"fullname": "name"+strconv.Itoa(i), "docid": u}, Infoshared: make(map[string]map[string]Credential)}
-		 id.Infoshared["fullname"] = make(map[string]Credential)
-     id.Infoshared["fullname"]["GOOGLE"]    = Credential{Token: "token1", ValidDay: 30}
-     id.Infoshared["fullname"]["FACEBOOK"]  = Credential{Token: "token2", ValidDay: 60}
+func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	for i := 1; i < 10; i++ {
+		u := deterministicID(APIstub, i)
+		id := ID{Claims: make(map[string]Claim), Infoshared: make(map[string]map[string]Credential)}
+		if err := setClaim(APIstub, &id, "fullname", "name"+strconv.Itoa(i)); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := setClaim(APIstub, &id, "docid", u); err != nil {
+			return shim.Error(err.Error())
+		}
+		salt := tokenSalt(APIstub.GetTxID(), strconv.Itoa(i))
+		id.Infoshared["GOOGLE"] = map[string]Credential{"fullname": {TokenHash: hashToken(salt, "token1"), Salt: salt, ValidDay: 30}}
+		id.Infoshared["FACEBOOK"] = map[string]Credential{"fullname": {TokenHash: hashToken(salt, "token2"), Salt: salt, ValidDay: 60}}
 
-		 idAsBytes, _ := json.Marshal(id)
-	 	 APIstub.PutState("ID"+strconv.Itoa(i), idAsBytes)
+		if err := putID(APIstub, "ID"+strconv.Itoa(i), id); err != nil {
+			return shim.Error(err.Error())
+		}
 	}
-  return shim.Success(nil)
+	return shim.Success(nil)
 }
 
-// generate random id to test
-func pseudo_uuid() (uuid string) {
-
-    b := make([]byte, 16)
-    _, err := rand.Read(b)
-    if err != nil {
-        fmt.Println("Error: ", err)
-        return
-    }
-
-    uuid = fmt.Sprintf("%X%X%X%X%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
-
-    return
+/*
+ * generate an id from the transaction id and a counter, so that every endorsing peer
+ * derives the same id. Use a different counter for each id of the same transaction.
+ */
+func deterministicID(APIstub shim.ChaincodeStubInterface, counter int) string {
+	b := sha256.Sum256([]byte(APIstub.GetTxID() + ":" + strconv.Itoa(counter)))
+	return fmt.Sprintf("%X%X%X%X%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // The main function is only relevant in unit test mode. Only included here for completeness.
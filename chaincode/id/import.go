@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Bulk import and export of identities, e.g. to move the customers of a legacy KYC database onto
+ * the ledger. An import can be re-run with the same batch: identities that already exist with the
+ * same claims are reported as unchanged, so a failed or interrupted migration is simply retried.
+ */
+
+// IMPORT_BATCH is the maximum number of identities of one importIdentities transaction
+const IMPORT_BATCH = 500
+
+// TRANSIENT_RECORDS is the transient map key that can carry the identities of importIdentities
+const TRANSIENT_RECORDS = "records"
+
+// Outcomes of an imported identity
+const (
+	IMPORT_CREATED   = "created"
+	IMPORT_UNCHANGED = "unchanged"
+	IMPORT_CONFLICT  = "conflict"
+	IMPORT_INVALID   = "invalid"
+)
+
+/*
+ * IdentityRecord is an identity of importIdentities and exportIdentities. Types holds the type of
+ * the claims that are not strings, see addClaim, and SecretHash the owner secret the identity is
+ * bound to: the hex SHA-256 of "<id>:<secret>", see ownerSecretHash.
+ */
+type IdentityRecord struct {
+	ID         string            `json:"id"`
+	Claims     map[string]string `json:"claims"`
+	Types      map[string]string `json:"types,omitempty"`
+	SecretHash string            `json:"secretHash,omitempty"`
+}
+
+// ImportResult is the outcome of one identity of importIdentities
+type ImportResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+/*
+ * IMPORT IDENTITIES (governance admins only), returns one result per identity in input order
+ * args: 0 => (JSON array of {"id": "...", "claims": {"fullname": "...", "docid": "...", ...},
+ *       "types": {"<claim>": "<type>", ...}, "secretHash": "..."}, types and secretHash optional)
+ * The identities can be sent in the transient map ("records") instead, they have to be when they
+ * are encrypted with a "claimKey".
+ */
+func (s *SmartContract) importIdentities(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	positional := len(args)
+	args, err := transientArgs(APIstub, args, 0, TRANSIENT_RECORDS)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	private := len(args) != positional
+	if err := checkArgs("importIdentities", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requirePrivateValues(APIstub, private); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	records := []IdentityRecord{}
+	if err := json.Unmarshal([]byte(args[0]), &records); err != nil {
+		return shim.Error("Identities must be a JSON array: " + err.Error())
+	}
+	if len(records) > IMPORT_BATCH {
+		return shim.Error(fmt.Sprintf("At most %d identities can be imported at once", IMPORT_BATCH))
+	}
+	key, err := transientClaimKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	results := []ImportResult{}
+	seen := map[string]bool{}
+	// the same docid twice in the batch opens a conflict too
+	batch := newDocBatch()
+	for _, record := range records {
+		result := ImportResult{ID: record.ID}
+		if seen[record.ID] {
+			result.Status = IMPORT_INVALID
+			result.Error = "duplicate id in the batch"
+		} else if err := importIdentity(APIstub, key, batch, record, &result); err != nil {
+			// ledger errors abort the whole batch, the import can be retried
+			return shim.Error(err.Error())
+		}
+		seen[record.ID] = true
+		results = append(results, result)
+	}
+
+	resultsAsBytes, _ := json.Marshal(results)
+	return shim.Success(resultsAsBytes)
+}
+
+/*
+ * importIdentity writes one identity and records the outcome in result. Only ledger errors are
+ * returned, invalid identities are reported in result.
+ */
+func importIdentity(APIstub shim.ChaincodeStubInterface, key []byte, batch *docBatch, record IdentityRecord, result *ImportResult) error {
+	result.Status = IMPORT_INVALID
+	if record.ID == "" || strings.ContainsRune(record.ID, 0) || recordKind(record.ID) != RECORD_ID {
+		result.Error = "invalid id"
+		return nil
+	}
+	for _, claim := range []string{"fullname", "docid"} {
+		if _, ok := record.Claims[claim]; !ok {
+			result.Error = "missing claim " + claim
+			return nil
+		}
+	}
+	if record.SecretHash != "" && !secretHashPattern.MatchString(record.SecretHash) {
+		result.Error = "secretHash must be a hex SHA-256 hash"
+		return nil
+	}
+	for claim := range record.Types {
+		if _, ok := record.Claims[claim]; !ok {
+			result.Error = "type of missing claim " + claim
+			return nil
+		}
+	}
+	if typ := record.Types["docid"]; typ != "" && typ != CLAIM_STRING {
+		result.Error = "docid must be a string"
+		return nil
+	}
+	claims := make([]string, 0, len(record.Claims))
+	for claim := range record.Claims {
+		claims = append(claims, claim)
+	}
+	sort.Strings(claims)
+	values := make(map[string]string, len(claims))
+	for _, claim := range claims {
+		value, err := normalizeValue(record.claimType(claim), record.Claims[claim])
+		if err != nil {
+			result.Error = fmt.Sprintf("%s: %s", claim, err.Error())
+			return nil
+		}
+		if err := validateClaim(APIstub, claim, record.claimType(claim), value); err != nil {
+			result.Error = err.Error()
+			return nil
+		}
+		values[claim] = value
+	}
+
+	idAsBytes, err := APIstub.GetState(record.ID)
+	if err != nil {
+		return err
+	}
+	if idAsBytes != nil {
+		existing, err := decodeID(record.ID, idAsBytes)
+		if err != nil {
+			return err
+		}
+		result.Status = IMPORT_UNCHANGED
+		if existing.SecretHash != record.SecretHash || !sameClaims(key, record, existing.Claims, values) {
+			result.Status = IMPORT_CONFLICT
+			result.Error = "User already exist with other claims"
+		}
+		return nil
+	}
+
+	id := ID{Claims: make(map[string]Claim), Infoshared: make(map[string]map[string]Credential), SecretHash: record.SecretHash}
+	for _, claim := range claims {
+		var elements []ClaimElement
+		if record.claimType(claim) == CLAIM_ARRAY {
+			if elements, err = newElements(APIstub, claim, values[claim]); err != nil {
+				result.Error = err.Error()
+				return nil
+			}
+		}
+		if err := setTypedClaim(APIstub, &id, record.ID, claim, record.claimType(claim), values[claim], elements); err != nil {
+			return err
+		}
+	}
+	if err := putID(APIstub, record.ID, id); err != nil {
+		return err
+	}
+	conflict, err := indexDocID(APIstub, batch, record.ID, record.Claims["docid"])
+	if err != nil {
+		return err
+	}
+	if conflict != "" {
+		result.Error = "docid already registered, conflict " + conflict
+	}
+	if err := ensureKeyPolicy(APIstub, record.ID); err != nil {
+		return err
+	}
+	result.Status = IMPORT_CREATED
+	return nil
+}
+
+// claimType is the type of an imported claim, a string unless Types says otherwise
+func (record IdentityRecord) claimType(claim string) string {
+	if typ := record.Types[claim]; typ != "" {
+		return typ
+	}
+	return CLAIM_STRING
+}
+
+// secretHashPattern is the form of the owner secret hashes of ID records
+var secretHashPattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// sameClaims reports whether the stored claims of the record's identity hold the imported values, of the same types
+func sameClaims(key []byte, record IdentityRecord, stored map[string]Claim, imported map[string]string) bool {
+	if len(stored) != len(imported) {
+		return false
+	}
+	for claim, value := range imported {
+		claimed, ok := stored[claim]
+		if !ok || claimType(claimed) != record.claimType(claim) {
+			return false
+		}
+		current := claimed.Value
+		if key != nil {
+			// encrypted values differ between transactions, compare the plaintext
+			if plain, err := openClaim(key, record.ID, claim, current); err == nil {
+				current = plain
+			}
+		}
+		if current != value {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * EXPORT IDENTITIES (governance admins only), one page of identities in key order
+ * args: 0 => (pageSize), 1 => (bookmark, optional, left out or empty for the first page)
+ * Returns {"records": [...], "fetched": n, "bookmark": "..."}, pass the bookmark to get the next
+ * page. The export is complete when fewer than pageSize keys were fetched, so a page can hold
+ * fewer records than were fetched. Encrypted claims are exported as they are stored, identities
+ * merged into another one are left out, their claims went to the survivor.
+ */
+func (s *SmartContract) exportIdentities(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("exportIdentities", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	bookmark := optionalArg(args, 1)
+	pageSize, err := strconv.Atoi(args[0])
+	if err != nil || pageSize <= 0 || pageSize > IMPORT_BATCH {
+		return shim.Error(fmt.Sprintf("pageSize must be a number between 1 and %d", IMPORT_BATCH))
+	}
+
+	// composite keys are outside the "" - "" range, only simple keys are scanned
+	resultsIterator, metadata, err := APIstub.GetStateByRangeWithPagination("", "", int32(pageSize), bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	records := []IdentityRecord{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if recordKind(queryResponse.Key) != RECORD_ID {
+			continue
+		}
+		id, err := decodeID(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if id.RedirectTo != "" {
+			continue
+		}
+		record := IdentityRecord{ID: queryResponse.Key, Claims: claimValues(id.Claims), SecretHash: id.SecretHash}
+		for name, claim := range id.Claims {
+			if typ := claimType(claim); typ != CLAIM_STRING {
+				if record.Types == nil {
+					record.Types = make(map[string]string)
+				}
+				record.Types[name] = typ
+			}
+		}
+		records = append(records, record)
+	}
+
+	page := map[string]interface{}{"records": records, "fetched": metadata.FetchedRecordsCount, "bookmark": metadata.Bookmark}
+	pageAsBytes, _ := json.Marshal(page)
+	return shim.Success(pageAsBytes)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func importRecords(t *testing.T, stub *testStub, records ...IdentityRecord) []ImportResult {
+	t.Helper()
+	recordsAsBytes, _ := json.Marshal(records)
+	stub.as(TEST_ORG, GOVERNANCE)
+	defer stub.as(TEST_ORG, "")
+	results := []ImportResult{}
+	if err := json.Unmarshal(stub.mustInvoke("importIdentities", string(recordsAsBytes)), &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestImportTypedClaimsWithSecret(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "age", "", `{"type": "integer", "minimum": 18}`, SENSITIVITY_LOW, "", "0")
+	stub.mustInvoke("registerClaimSchema", "phones", "", `{"type": "array"}`, SENSITIVITY_LOW, "", "0")
+	record := IdentityRecord{
+		ID:         "alice",
+		Claims:     map[string]string{"fullname": "Alice", "docid": "P1", "age": "30", "phones": `["555", "556"]`},
+		Types:      map[string]string{"age": CLAIM_NUMBER, "phones": CLAIM_ARRAY},
+		SecretHash: ownerSecretHash("alice", []byte("alice")),
+	}
+	if results := importRecords(t, stub, record); results[0].Status != IMPORT_CREATED {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	id := stub.getID("alice")
+	if id.Claims["age"].Type != CLAIM_NUMBER || len(id.Claims["phones"].Elements) != 2 || id.SecretHash != record.SecretHash {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	// the imported secret proves the ownership like one given to createId
+	stub.with(TRANSIENT_SECRET, "alice")
+	stub.mustInvoke("queryReceiptsByUser", "alice")
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("queryReceiptsByUser", "alice")
+
+	if results := importRecords(t, stub, record); results[0].Status != IMPORT_UNCHANGED {
+		t.Errorf("a re-run of the import changed: %+v", results)
+	}
+	changed := record
+	changed.Claims = map[string]string{"fullname": "Alice", "docid": "P1", "age": "30", "phones": `["555"]`}
+	rehashed := record
+	rehashed.SecretHash = ownerSecretHash("alice", []byte("other"))
+	for _, other := range []IdentityRecord{changed, rehashed} {
+		if results := importRecords(t, stub, other); results[0].Status != IMPORT_CONFLICT {
+			t.Errorf("unexpected results %+v", results)
+		}
+	}
+
+	for _, invalid := range []IdentityRecord{
+		{ID: "bob", Claims: map[string]string{"fullname": "Bob", "docid": "P2", "age": "x"}, Types: map[string]string{"age": CLAIM_NUMBER}},
+		{ID: "bob", Claims: map[string]string{"fullname": "Bob", "docid": "P2"}, Types: map[string]string{"age": CLAIM_NUMBER}},
+		{ID: "bob", Claims: map[string]string{"fullname": "Bob", "docid": "P2"}, SecretHash: "secret"},
+		{ID: "bob", Claims: map[string]string{"fullname": "Bob", "docid": "2"}, Types: map[string]string{"docid": CLAIM_NUMBER}},
+	} {
+		if results := importRecords(t, stub, invalid); results[0].Status != IMPORT_INVALID {
+			t.Errorf("an invalid record was imported: %+v", results)
+		}
+	}
+}
+
+func TestExportKeepsTypesAndSecret(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "age", "", `{"type": "integer"}`, SENSITIVITY_LOW, "", "0")
+	stub.as(TEST_ORG, "")
+	stub.with(TRANSIENT_VALUE, "30")
+	stub.mustInvoke("addClaim", "alice", "age", CLAIM_NUMBER)
+
+	stub.as(TEST_ORG, GOVERNANCE)
+	page := struct {
+		Records []IdentityRecord `json:"records"`
+	}{}
+	if err := json.Unmarshal(stub.mustInvoke("exportIdentities", "10"), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 1 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+	record := page.Records[0]
+	if record.Types["age"] != CLAIM_NUMBER || record.Types["fullname"] != "" || record.SecretHash != ownerSecretHash("alice", []byte("alice")) {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	// the export imports as it is into another ledger
+	other := newTestStub(t)
+	other.as(TEST_ORG, GOVERNANCE)
+	other.mustInvoke("registerClaimSchema", "age", "", `{"type": "integer"}`, SENSITIVITY_LOW, "", "0")
+	if results := importRecords(t, other, record); results[0].Status != IMPORT_CREATED {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if id := other.getID("alice"); id.Claims["age"].Type != CLAIM_NUMBER || id.SecretHash != record.SecretHash {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
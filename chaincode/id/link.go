@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Linking and merging identities of the same person, e.g. after a bulk load or a re-registration.
+ * Owners prove they own an identity with the secret it was created with (transient "secret").
+ * Two identities are linked once both owners called linkIdentities towards the other one. A linked
+ * identity can then be merged into the other: its claims, shares and attestations move to the
+ * survivor and its key is left as a tombstone redirecting to the survivor.
+ */
+
+// IDENTITY_LINK is the composite key of the consent of user to be linked with other
+const IDENTITY_LINK = "identityLink~user~other"
+
+// MAX_REDIRECTS bounds the tombstones followed to reach a surviving identity
+const MAX_REDIRECTS = 8
+
+/*
+ * LINK IDENTITIES, the owner of idClient consents to be linked with other
+ * args: 0 => (idClient), 1 => (other idClient)
+ * The secret of idClient is sent in the transient map ("secret").
+ * Returns "linked" once the owner of other consented too, "pending" otherwise.
+ */
+func (s *SmartContract) linkIdentities(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("linkIdentities", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[0] == args[1] {
+		return shim.Error("An identity can not be linked with itself")
+	}
+	if err := requireOwner(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getID(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	key, err := APIstub.CreateCompositeKey(IDENTITY_LINK, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := APIstub.PutState(key, []byte(APIstub.GetTxID())); err != nil {
+		return shim.Error(err.Error())
+	}
+	linked, err := consented(APIstub, args[1], args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if linked {
+		return shim.Success([]byte("linked"))
+	}
+	return shim.Success([]byte("pending"))
+}
+
+/*
+ * QUERY LINKED IDENTITIES, the identities linked with idClient by both owners
+ * args: 0 => (idClient)
+ */
+func (s *SmartContract) queryLinkedIdentities(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryLinkedIdentities", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(IDENTITY_LINK, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	linked := []string{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		back, err := consented(APIstub, keyParts[1], args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if back {
+			linked = append(linked, keyParts[1])
+		}
+	}
+	linkedAsBytes, _ := json.Marshal(linked)
+	return shim.Success(linkedAsBytes)
+}
+
+/*
+ * MERGE IDENTITIES, moves a linked identity into the survivor and leaves a redirect tombstone.
+ * Claims and shares the survivor already has are kept, encrypted claims are moved when the
+ * transient map carries their "claimKey". Attestations only follow the claims that reach the
+ * survivor with the value they were made for, and the docid index entry of the merged identity
+ * only when the survivor holds the same number.
+ * args: 0 => (survivor idClient), 1 => (merged idClient)
+ * The secret of the merged identity is sent in the transient map ("secret").
+ */
+func (s *SmartContract) mergeIdentities(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("mergeIdentities", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	survivor, merged := args[0], args[1]
+	if err := requireOwner(APIstub, merged); err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, pair := range [][2]string{{survivor, merged}, {merged, survivor}} {
+		ok, err := consented(APIstub, pair[0], pair[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !ok {
+			return shim.Error(fmt.Sprintf("%s and %s are not linked", survivor, merged))
+		}
+	}
+	survivorID, err := getID(APIstub, survivor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	mergedID, err := getID(APIstub, merged)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := transientClaimKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// claims, re-encrypted for the survivor since ciphertexts are bound to their user. moved are
+	// the claims and elements the survivor ends up with the value they had in merged, only their
+	// attestations follow them.
+	moved := map[string]bool{}
+	for _, claim := range claimNames(mergedID.Claims) {
+		if kept, exist := survivorID.Claims[claim]; exist {
+			same, err := sameClaimValue(key, survivor, kept, merged, mergedID.Claims[claim], claim)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if same {
+				moved[claim] = true
+				if kept.Attestation == "" && mergedID.Claims[claim].Attestation != "" {
+					kept.Source, kept.Attestation = mergedID.Claims[claim].Source, mergedID.Claims[claim].Attestation
+					survivorID.Claims[claim] = kept
+				}
+			}
+			continue
+		}
+		resealed, err := resealClaim(APIstub, key, merged, survivor, claim, mergedID.Claims[claim])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		survivorID.Claims[claim] = resealed
+		moved[claim] = true
+		for _, element := range resealed.Elements {
+			moved[claim+ELEMENT_SEP+element.ID] = true
+		}
+	}
+
+	// shares, pseudonyms the relying parties know now resolve to the survivor
+	relyingParties := make([]string, 0, len(mergedID.Infoshared))
+	for relyingParty := range mergedID.Infoshared {
+		relyingParties = append(relyingParties, relyingParty)
+	}
+	sort.Strings(relyingParties)
+	for _, relyingParty := range relyingParties {
+		if _, ok := survivorID.Infoshared[relyingParty]; !ok {
+			survivorID.Infoshared[relyingParty] = make(map[string]Credential)
+		}
+		for claim, credential := range mergedID.Infoshared[relyingParty] {
+			if _, exist := survivorID.Infoshared[relyingParty][claim]; exist {
+				continue
+			}
+			survivorID.Infoshared[relyingParty][claim] = credential
+		}
+		if err := movePseudonym(APIstub, merged, survivor, relyingParty); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	if err := mergeAttestations(APIstub, survivor, merged, moved); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := mergeDocIndexEntry(APIstub, key, survivor, survivorID, merged, mergedID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putID(APIstub, survivor, survivorID); err != nil {
+		return shim.Error(err.Error())
+	}
+	tombstone := ID{Claims: map[string]Claim{}, Infoshared: map[string]map[string]Credential{}, RedirectTo: survivor}
+	if err := putID(APIstub, merged, tombstone); err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, pair := range [][]string{{survivor, merged}, {merged, survivor}} {
+		linkKey, err := APIstub.CreateCompositeKey(IDENTITY_LINK, pair)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := APIstub.DelState(linkKey); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	return shim.Success(nil)
+}
+
+/*
+ * SET OWNER SECRET (governance admins only), binds an identity created without an owner secret,
+ * by initLedger or an import without secretHash, to the secret whose hash is given, see
+ * ownerSecretHash. The secret of an identity that has one is never replaced.
+ * args: 0 => (idClient), 1 => (secretHash, hex SHA-256 of "<idClient>:<secret>")
+ */
+func (s *SmartContract) setOwnerSecret(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("setOwnerSecret", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !secretHashPattern.MatchString(args[1]) {
+		return shim.Error("secretHash must be a hex SHA-256 hash")
+	}
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if id.SecretHash != "" {
+		return shim.Error(fmt.Sprintf("%s already has an owner secret", args[0]))
+	}
+	id.SecretHash = args[1]
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * mergeAttestations moves the attestations and attestation requests of merged to survivor in
+ * every attester_<id> and requestAttest_<id> document and in the request rows, with the rows
+ * kept per attestation. Only the claims in moved are carried over, the others are dropped with
+ * their rows and the deposits of their requests are refunded.
+ */
+func mergeAttestations(APIstub shim.ChaincodeStubInterface, survivor string, merged string, moved map[string]bool) error {
+	if err := mergeAttestDocuments(APIstub, ATTEST, survivor, merged, moved, ATTESTATION_PATH); err != nil {
+		return err
+	}
+	if err := mergeAttestDocuments(APIstub, REQUEST, survivor, merged, moved, REQUEST_TIME, DEPOSIT_LOCK); err != nil {
+		return err
+	}
+	return mergeAttestRequests(APIstub, survivor, merged, moved)
+}
+
+func mergeAttestDocuments(APIstub shim.ChaincodeStubInterface, prefix string, survivor string, merged string, moved map[string]bool, rows ...string) error {
+	resultsIterator, err := APIstub.GetStateByRange(prefix, prefix+string(utf8.MaxRune))
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		document, err := decodeAttestClaim(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return err
+		}
+		claims, ok := document.Claim[merged]
+		if !ok {
+			continue
+		}
+		if _, ok := document.Claim[survivor]; !ok {
+			document.Claim[survivor] = make(map[string]string)
+		}
+		attester := strings.TrimPrefix(queryResponse.Key, prefix)
+		for _, claim := range sortedKeys(claims) {
+			// the survivor keeps its own entry, and an entry made for another value is dropped
+			if _, exist := document.Claim[survivor][claim]; exist || !moved[claim] {
+				if err := dropRows(APIstub, prefix, attester, merged, claim, rows); err != nil {
+					return err
+				}
+				continue
+			}
+			document.Claim[survivor][claim] = claims[claim]
+			for _, row := range rows {
+				if err := moveRow(APIstub, row, []string{attester, merged, claim}, []string{attester, survivor, claim}); err != nil {
+					return err
+				}
+			}
+		}
+		if len(document.Claim[survivor]) == 0 {
+			delete(document.Claim, survivor)
+		}
+		delete(document.Claim, merged)
+		if err := putAttestClaim(APIstub, queryResponse.Key, document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropRows deletes the rows of an entry of an attester document, refunding the deposit of a request
+func dropRows(APIstub shim.ChaincodeStubInterface, prefix string, attester string, user string, claim string, rows []string) error {
+	if prefix == REQUEST {
+		if err := releaseDeposit(APIstub, attester, user, claim, true); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		key, err := APIstub.CreateCompositeKey(row, []string{attester, user, claim})
+		if err != nil {
+			return err
+		}
+		if err := APIstub.DelState(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * sameClaimValue reports whether two users hold the same value of a claim. Encrypted values are
+ * compared when the claimKey is given and are otherwise taken as different.
+ */
+func sameClaimValue(key []byte, user string, claim Claim, other string, otherClaim Claim, name string) (bool, error) {
+	if key == nil && (encryptedClaim(claim) || encryptedClaim(otherClaim)) {
+		return false, nil
+	}
+	opened, err := openTypedClaim(key, user, name, claim)
+	if err != nil {
+		return false, err
+	}
+	otherOpened, err := openTypedClaim(key, other, name, otherClaim)
+	if err != nil {
+		return false, err
+	}
+	return opened.Type == otherOpened.Type && opened.Value == otherOpened.Value, nil
+}
+
+// moveRow moves the state under the composite key from to the composite key to
+func moveRow(APIstub shim.ChaincodeStubInterface, objectType string, from []string, to []string) error {
+	fromKey, err := APIstub.CreateCompositeKey(objectType, from)
+	if err != nil {
+		return err
+	}
+	value, err := APIstub.GetState(fromKey)
+	if err != nil || value == nil {
+		return err
+	}
+	toKey, err := APIstub.CreateCompositeKey(objectType, to)
+	if err != nil {
+		return err
+	}
+	if err := APIstub.PutState(toKey, value); err != nil {
+		return err
+	}
+	return APIstub.DelState(fromKey)
+}
+
+/*
+ * requireOwner checks the transaction carries the secret the user was created with
+ */
+func requireOwner(APIstub shim.ChaincodeStubInterface, user string) error {
+	secret, err := transientSecret(APIstub)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return fmt.Errorf("The secret of %s is required in the transient map", user)
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return err
+	}
+	return checkSecret(user, id, secret)
+}
+
+/*
+ * ownerQuery reports whether a query about user was made by its owner: false when the transient
+ * map carries no secret, an error when it carries a wrong one
+ */
+func ownerQuery(APIstub shim.ChaincodeStubInterface, user string) (bool, error) {
+	secret, err := transientSecret(APIstub)
+	if err != nil || secret == nil {
+		return false, err
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return false, err
+	}
+	return true, checkSecret(user, id, secret)
+}
+
+// consented reports whether the owner of user consented to be linked with other
+func consented(APIstub shim.ChaincodeStubInterface, user string, other string) (bool, error) {
+	key, err := APIstub.CreateCompositeKey(IDENTITY_LINK, []string{user, other})
+	if err != nil {
+		return false, err
+	}
+	consent, err := APIstub.GetState(key)
+	return consent != nil, err
+}
+
+/*
+ * followRedirects returns the identity key that user was merged into, user itself when it was not merged
+ */
+func followRedirects(APIstub shim.ChaincodeStubInterface, user string) (string, error) {
+	for i := 0; i < MAX_REDIRECTS; i++ {
+		idAsBytes, err := APIstub.GetState(user)
+		if err != nil || idAsBytes == nil {
+			return user, err
+		}
+		id, err := decodeID(user, idAsBytes)
+		if err != nil {
+			return user, err
+		}
+		if id.RedirectTo == "" {
+			return user, nil
+		}
+		user = id.RedirectTo
+	}
+	return user, fmt.Errorf("Too many redirects")
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
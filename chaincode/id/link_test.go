@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLinkIdentities(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.createID("bob", "P2")
+
+	if message := stub.mustFail("linkIdentities", "alice", "bob"); !strings.Contains(message, "secret of alice is required") {
+		t.Errorf("linked without the secret: %s", message)
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("linkIdentities", "alice", "bob")
+	stub.with(TRANSIENT_SECRET, "alice")
+	stub.mustFail("linkIdentities", "alice", "alice")
+
+	stub.with(TRANSIENT_SECRET, "alice")
+	if status := string(stub.mustInvoke("linkIdentities", "alice", "bob")); status != "pending" {
+		t.Errorf("first consent gave %s", status)
+	}
+	if linked := string(stub.mustInvoke("queryLinkedIdentities", "alice")); linked != "[]" {
+		t.Errorf("linked before bob consented: %s", linked)
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	if status := string(stub.mustInvoke("linkIdentities", "bob", "alice")); status != "linked" {
+		t.Errorf("second consent gave %s", status)
+	}
+	if linked := string(stub.mustInvoke("queryLinkedIdentities", "alice")); linked != `["bob"]` {
+		t.Errorf("alice is linked with %s", linked)
+	}
+}
+
+func TestMergeIdentities(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "rp", TEST_ORG, TEST_CONTROLLER)
+	stub.mustInvoke("registerParty", "acme", TEST_ORG)
+	stub.mustInvoke("registerClaimSchema", "email", ".+@.+", "", SENSITIVITY_MEDIUM, "", "30")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+	stub.createID("bob", "P2")
+	stub.with(TRANSIENT_VALUE, "bob@example.com")
+	stub.mustInvoke("addClaim", "bob", "email")
+	stub.with(TRANSIENT_TOKEN, "token", TRANSIENT_SECRET, "bob")
+	stub.mustInvoke("shareinfo", "bob", "rp", "email")
+	pseudonym := pairwisePseudonym([]byte("bob"), "rp")
+	stub.mustInvoke("requestAttestation", "acme", "bob", "email", "url")
+
+	stub.with(TRANSIENT_SECRET, "bob")
+	if message := stub.mustFail("mergeIdentities", "alice", "bob"); message != "alice and bob are not linked" {
+		t.Errorf("merged without consent: %s", message)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		stub.with(TRANSIENT_SECRET, user)
+		stub.mustInvoke("linkIdentities", user, map[string]string{"alice": "bob", "bob": "alice"}[user])
+	}
+	// the secret of the merged identity is needed, not the one of the survivor
+	stub.with(TRANSIENT_SECRET, "alice")
+	stub.mustFail("mergeIdentities", "alice", "bob")
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustInvoke("mergeIdentities", "alice", "bob")
+
+	if tombstone := stub.getID("bob"); tombstone.RedirectTo != "alice" || len(tombstone.Claims) != 0 {
+		t.Errorf("unexpected tombstone %+v", tombstone)
+	}
+	alice := stub.getID("alice")
+	if alice.Claims["fullname"].Value != "Name of alice" || alice.Claims["docid"].Value != "P1" {
+		t.Errorf("the claims of the survivor were overwritten: %+v", alice.Claims)
+	}
+	if alice.Claims["email"].Value != "bob@example.com" {
+		t.Errorf("the email of bob was not moved: %+v", alice.Claims)
+	}
+	if !alice.Infoshared["rp"]["email"].Pseudonymous {
+		t.Errorf("the share of bob was not moved: %+v", alice.Infoshared)
+	}
+	if user, err := resolveUser(stub, pseudonym, "rp"); err != nil || user != "alice" {
+		t.Errorf("the pseudonym of bob resolves to %s %v", user, err)
+	}
+	if requested, _ := attestRequested(stub, "acme", "alice", "email"); !requested || countRows(stub, ATTEST_REQUEST) != 1 {
+		t.Errorf("the request of the email of bob was not moved")
+	}
+
+	survivor := ID{}
+	if err := json.Unmarshal(stub.mustInvoke("getUserById", "bob"), &survivor); err != nil {
+		t.Fatal(err)
+	}
+	if survivor.Claims["docid"].Value != "P1" {
+		t.Errorf("bob does not redirect to alice: %+v", survivor)
+	}
+	if linked := string(stub.mustInvoke("queryLinkedIdentities", "alice")); linked != "[]" {
+		t.Errorf("the link was kept after the merge: %s", linked)
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("linkIdentities", "bob", "alice")
+}
+
+func TestLinkIdentitiesWithoutCreationSecret(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	importRecords(t, stub,
+		IdentityRecord{ID: "bob", Claims: map[string]string{"fullname": "Bob", "docid": "P2"}, SecretHash: ownerSecretHash("bob", []byte("bob"))},
+		IdentityRecord{ID: "carol", Claims: map[string]string{"fullname": "Carol", "docid": "P3"}},
+	)
+
+	// the secret hash of the import proves the ownership of bob
+	for _, user := range []string{"alice", "bob"} {
+		stub.with(TRANSIENT_SECRET, user)
+		stub.mustInvoke("linkIdentities", user, map[string]string{"alice": "bob", "bob": "alice"}[user])
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustInvoke("mergeIdentities", "alice", "bob")
+
+	// carol was imported without one, governance binds it
+	stub.with(TRANSIENT_SECRET, "carol")
+	if message := stub.mustFail("linkIdentities", "carol", "alice"); !strings.HasPrefix(message, "carol has no owner secret") {
+		t.Errorf("unexpected error %s", message)
+	}
+	hash := ownerSecretHash("carol", []byte("carol"))
+	stub.mustFail("setOwnerSecret", "carol", hash)
+	stub.as(TEST_ORG, GOVERNANCE)
+	if message := stub.mustFail("setOwnerSecret", "carol", "carol"); message != "secretHash must be a hex SHA-256 hash" {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.mustInvoke("setOwnerSecret", "carol", hash)
+	for _, user := range []string{"alice", "carol"} {
+		if message := stub.mustFail("setOwnerSecret", user, hash); message != user+" already has an owner secret" {
+			t.Errorf("the owner secret of %s was replaced: %s", user, message)
+		}
+	}
+	if message := stub.mustFail("setOwnerSecret", "bob", hash); message != "User bob was merged into alice" {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.with(TRANSIENT_SECRET, "carol")
+	stub.mustInvoke("linkIdentities", "carol", "alice")
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Simple (non composite) keys only hold versioned records: ID records under the user key and
+ * AttestClaim documents under REQUEST/ATTEST prefixed keys. Everything else this chaincode stores
+ * lives under composite keys, so a range scan over the simple keys visits every versioned record.
+ */
+
+// Kinds of versioned records
+const (
+	RECORD_ID     = "id"
+	RECORD_ATTEST = "attest"
+)
+
+// MIGRATION is the composite key object type holding the progress of the ledger migration
+const MIGRATION = "migration~state"
+
+// MIGRATION_BATCH is the number of records migrated by Init, larger ledgers finish with migrateBatch
+const MIGRATION_BATCH = 500
+
+// migrations[i] upgrades the decoded record stored under key from version i to version i+1
+var migrations = []func(kind string, key string, record map[string]interface{}) error{
+	// 0 => 1: records written before versioning, only the version field is added
+	func(kind string, key string, record map[string]interface{}) error { return nil },
+	// 1 => 2: share tokens are replaced by their salted hash
+	hashShareTokens,
+	// 2 => 3: claim values become claims with metadata
+	claimMetadata,
+	// 3 => 4: credentials no longer name the pseudonym they were shared under
+	pseudonymousShares,
+}
+
+// MigrationState tracks a resumable migration of the ledger to Version
+type MigrationState struct {
+	Version  int    `json:"version"`
+	Cursor   string `json:"cursor"`
+	Migrated int    `json:"migrated"`
+	Done     bool   `json:"done"`
+}
+
+/*
+ * MIGRATE A BATCH OF RECORDS (governance admins only)
+ * args: 0 => (batchSize)
+ */
+func (s *SmartContract) migrateBatch(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("migrateBatch", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	batchSize, err := strconv.Atoi(args[0])
+	if err != nil || batchSize <= 0 {
+		return shim.Error("batchSize must be a positive number")
+	}
+
+	state, err := migrateLedger(APIstub, batchSize)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stateAsBytes, _ := json.Marshal(state)
+	return shim.Success(stateAsBytes)
+}
+
+/*
+ * migrateLedger upgrades at most limit records to ID_VERSION, resuming where the previous batch stopped
+ */
+func migrateLedger(APIstub shim.ChaincodeStubInterface, limit int) (MigrationState, error) {
+	stateKey, err := APIstub.CreateCompositeKey(MIGRATION, []string{})
+	if err != nil {
+		return MigrationState{}, err
+	}
+	state := MigrationState{}
+	stateAsBytes, err := APIstub.GetState(stateKey)
+	if err != nil {
+		return state, err
+	}
+	if stateAsBytes != nil {
+		if err := strictUnmarshal(stateAsBytes, &state); err != nil {
+			return state, fmt.Errorf("Corrupted migration state: %s", err.Error())
+		}
+	}
+	// a new chaincode version restarts the migration from the first key
+	if state.Version != ID_VERSION {
+		state = MigrationState{Version: ID_VERSION}
+	}
+	if state.Done {
+		return state, nil
+	}
+
+	resultsIterator, err := APIstub.GetStateByRange(state.Cursor, "")
+	if err != nil {
+		return state, err
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for count < limit && resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return state, err
+		}
+		recordAsBytes, err := migrateRecord(recordKind(queryResponse.Key), queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return state, fmt.Errorf("Cannot migrate %s: %s", queryResponse.Key, err.Error())
+		}
+		if !bytes.Equal(recordAsBytes, queryResponse.Value) {
+			if err := APIstub.PutState(queryResponse.Key, recordAsBytes); err != nil {
+				return state, err
+			}
+			state.Migrated++
+		}
+		// the smallest key after the one just migrated
+		state.Cursor = queryResponse.Key + "\x00"
+		count++
+	}
+	state.Done = !resultsIterator.HasNext()
+
+	stateAsBytes, _ = json.Marshal(state)
+	if err := APIstub.PutState(stateKey, stateAsBytes); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+func recordKind(key string) string {
+	if strings.HasPrefix(key, REQUEST) || strings.HasPrefix(key, ATTEST) {
+		return RECORD_ATTEST
+	}
+	return RECORD_ID
+}
+
+/*
+ * migrateRecord applies the migrations a record is missing and returns it encoded at ID_VERSION.
+ * Records already at ID_VERSION are returned unchanged.
+ */
+func migrateRecord(kind string, key string, recordAsBytes []byte) ([]byte, error) {
+	if len(migrations) != ID_VERSION {
+		return nil, fmt.Errorf("Missing migrations up to version %d", ID_VERSION)
+	}
+
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(recordAsBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if v, ok := record["version"]; ok {
+		number, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("Invalid record version %v", v)
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid record version %v", v)
+		}
+		version = int(n)
+	}
+	if version > ID_VERSION {
+		return nil, fmt.Errorf("Record version %d is newer than this chaincode (%d)", version, ID_VERSION)
+	}
+	if version == ID_VERSION {
+		return recordAsBytes, nil
+	}
+
+	for ; version < ID_VERSION; version++ {
+		if err := migrations[version](kind, key, record); err != nil {
+			return nil, fmt.Errorf("Migration to version %d failed: %s", version+1, err.Error())
+		}
+	}
+	record["version"] = ID_VERSION
+	return json.Marshal(record)
+}
+
+// hashShareTokens replaces the plaintext token of every credential of an ID by its salted hash
+func hashShareTokens(kind string, key string, record map[string]interface{}) error {
+	if kind != RECORD_ID {
+		return nil
+	}
+	infoshared, ok := record["infoshared"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for relyingParty, shared := range infoshared {
+		claims, ok := shared.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid infoshared of %s", relyingParty)
+		}
+		for claim, c := range claims {
+			credential, ok := c.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("Invalid credential of %s for %s", claim, relyingParty)
+			}
+			token, _ := credential["token"].(string)
+			delete(credential, "token")
+			credential["salt"] = tokenSalt(key, relyingParty, claim)
+			credential["tokenHash"] = hashToken(credential["salt"].(string), token)
+		}
+	}
+	return nil
+}
+
+/*
+ * claimMetadata turns every claim value of an ID into a self asserted claim. When and by whom the
+ * value was set was not recorded, those fields stay empty.
+ */
+func claimMetadata(kind string, key string, record map[string]interface{}) error {
+	if kind != RECORD_ID {
+		return nil
+	}
+	claims, ok := record["claims"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for name, value := range claims {
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("Invalid value of claim %s", name)
+		}
+		claims[name] = map[string]interface{}{"value": text, "source": SOURCE_SELF, "created": 0, "updated": 0, "txId": ""}
+	}
+	return nil
+}
+
+/*
+ * pseudonymousShares replaces the pseudonym of every credential of an ID by a flag, the pseudonym
+ * itself is mapped to the user in the private data collection by movePublicPseudonyms
+ */
+func pseudonymousShares(kind string, key string, record map[string]interface{}) error {
+	if kind != RECORD_ID {
+		return nil
+	}
+	infoshared, ok := record["infoshared"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for relyingParty, shared := range infoshared {
+		claims, ok := shared.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid infoshared of %s", relyingParty)
+		}
+		for claim, c := range claims {
+			credential, ok := c.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("Invalid credential of %s for %s", claim, relyingParty)
+			}
+			if pseudonym, _ := credential["pseudonym"].(string); pseudonym != "" {
+				credential["pseudonymous"] = true
+			}
+			delete(credential, "pseudonym")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ID record as written before versioning, with a plain share token and a pseudonym
+const V0_ID = `{"claims": {"fullname": "Jane Doe"}, "infoshared": {"rp": {"fullname": {"token": "t", "validDay": 5, "pseudonym": "p"}}}}`
+
+func TestMigrateRecord(t *testing.T) {
+	recordAsBytes, err := migrateRecord(RECORD_ID, "u", []byte(V0_ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ID{}
+	if err := strictUnmarshal(recordAsBytes, &id); err != nil {
+		t.Fatalf("migrated record does not decode: %s", err.Error())
+	}
+	if id.Version != ID_VERSION {
+		t.Errorf("version %d, want %d", id.Version, ID_VERSION)
+	}
+	if claim := id.Claims["fullname"]; claim.Value != "Jane Doe" || claim.Source != SOURCE_SELF {
+		t.Errorf("unexpected claim %+v", claim)
+	}
+	credential := id.Infoshared["rp"]["fullname"]
+	if !credential.Pseudonymous || credential.ValidDay != 5 {
+		t.Errorf("unexpected credential %+v", credential)
+	}
+	if credential.TokenHash != hashToken(credential.Salt, "t") {
+		t.Errorf("the token was not replaced by its hash")
+	}
+
+	// current records are left alone, newer ones refused
+	again, err := migrateRecord(RECORD_ID, "u", recordAsBytes)
+	if err != nil || !bytes.Equal(again, recordAsBytes) {
+		t.Errorf("a current record was rewritten: %v", err)
+	}
+	if _, err := migrateRecord(RECORD_ID, "u", []byte(`{"version": 99}`)); err == nil {
+		t.Errorf("a record newer than the chaincode was migrated")
+	}
+
+	attest, err := migrateRecord(RECORD_ATTEST, ATTEST+"a", []byte(`{"claim": {"u": {"fullname": "hash"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeAttestClaim(ATTEST+"a", attest); err != nil {
+		t.Errorf("migrated attestation does not decode: %s", err.Error())
+	}
+}
+
+func TestMigrateLedgerInBatches(t *testing.T) {
+	stub := &testStub{MockStub: shim.NewMockStub("identity", new(SmartContract)), t: t, private: map[string][]byte{}}
+	stub.start()
+	for _, user := range []string{"u1", "u2", "u3"} {
+		stub.PutState(user, []byte(V0_ID))
+	}
+	partyKey, _ := stub.CreateCompositeKey(PARTY, []string{"rp"})
+	stub.PutState(partyKey, []byte(`{"name": "rp"}`))
+
+	state, err := migrateLedger(stub, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Migrated != 2 || state.Done {
+		t.Errorf("first batch: %+v", state)
+	}
+	state, err = migrateLedger(stub, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Migrated != 3 || !state.Done {
+		t.Errorf("second batch: %+v", state)
+	}
+	for _, user := range []string{"u1", "u2", "u3"} {
+		if id := stub.getID(user); id.Version != ID_VERSION {
+			t.Errorf("%s is at version %d", user, id.Version)
+		}
+	}
+	if string(stub.State[partyKey]) != `{"name": "rp"}` {
+		t.Errorf("a composite key was migrated")
+	}
+
+	// done, a new record written by an old peer is only picked up by the next version
+	stub.PutState("u4", []byte(V0_ID))
+	if state, err = migrateLedger(stub, 10); err != nil || state.Migrated != 3 {
+		t.Errorf("a finished migration ran again: %+v %v", state, err)
+	}
+}
+
+func TestMigrateLedgerRestartsOnNewVersion(t *testing.T) {
+	stub := &testStub{MockStub: shim.NewMockStub("identity", new(SmartContract)), t: t, private: map[string][]byte{}}
+	stub.start()
+	stub.PutState("u1", []byte(V0_ID))
+	stateKey, _ := stub.CreateCompositeKey(MIGRATION, []string{})
+	previous, _ := json.Marshal(MigrationState{Version: ID_VERSION - 1, Cursor: "u2", Done: true})
+	stub.PutState(stateKey, previous)
+
+	state, err := migrateLedger(stub, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != ID_VERSION || state.Migrated != 1 || !state.Done {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	stub.PutState(stateKey, []byte(`{"version": 4, "cursor": "", "pending": 1}`))
+	if _, err := migrateLedger(stub, 10); err == nil || !strings.HasPrefix(err.Error(), "Corrupted migration state") {
+		t.Errorf("a corrupted migration state was accepted: %v", err)
+	}
+}
+
+func TestMigrateBatchRequiresGovernance(t *testing.T) {
+	stub := newTestStub(t)
+	stub.mustFail("migrateBatch", "10")
+	stub.as(TEST_ORG, GOVERNANCE)
+	if message := stub.mustFail("migrateBatch", "0"); message != "batchSize must be a positive number" {
+		t.Errorf("unexpected error %s", message)
+	}
+	state := MigrationState{}
+	if err := json.Unmarshal(stub.mustInvoke("migrateBatch", "10"), &state); err != nil || !state.Done {
+		t.Errorf("unexpected state %+v %v", state, err)
+	}
+}
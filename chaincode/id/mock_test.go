@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * testStub runs the chaincode on shim.MockStub with what the mock leaves out: the creator and the
+ * transient map of the proposal, the private data collection, and range queries that are open
+ * ended and skip composite keys like the peer does.
+ */
+type testStub struct {
+	*shim.MockStub
+	t         *testing.T
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+	private   map[string][]byte
+	tx        int
+}
+
+// TEST_ORG is the MSP id of the clients the tests sign with
+const TEST_ORG = "Org1MSP"
+
+// TEST_CONTROLLER are the controller details relying parties are registered with
+const TEST_CONTROLLER = `{"contact": "DPO", "email": "dpo@rp", "policyUrl": "https://rp/policy"}`
+
+// attrOID is the x509 extension the Fabric CA writes the attributes of a certificate to
+var attrOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// newTestStub instantiates the chaincode and sets the key of the docid index
+func newTestStub(t *testing.T) *testStub {
+	stub := &testStub{MockStub: shim.NewMockStub("identity", new(SmartContract)), t: t, private: map[string][]byte{}}
+	stub.as(TEST_ORG, GOVERNANCE)
+	if response := stub.init(); response.Status != shim.OK {
+		t.Fatalf("Init failed: %s", response.Message)
+	}
+	stub.with(TRANSIENT_DOC_INDEX_KEY, strings.Repeat("k", 32))
+	stub.mustInvoke("setDocIndexKey")
+	stub.as(TEST_ORG, "")
+	return stub
+}
+
+// as signs the next transactions with a client of org, role is its id.role attribute
+func (s *testStub) as(org string, role string) {
+	s.creator = testCreator(s.t, org, role)
+}
+
+// with sets the transient map of the next transaction, from key, value pairs
+func (s *testStub) with(pairs ...string) {
+	s.transient = map[string][]byte{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		s.transient[pairs[i]] = []byte(pairs[i+1])
+	}
+}
+
+func (s *testStub) init() sc.Response {
+	s.start()
+	defer s.end()
+	return new(SmartContract).Init(s)
+}
+
+// invoke runs function in a transaction of its own, the transient map only lasts for it
+func (s *testStub) invoke(function string, args ...string) sc.Response {
+	s.args = [][]byte{[]byte(function)}
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.start()
+	defer s.end()
+	return new(SmartContract).Invoke(s)
+}
+
+func (s *testStub) mustInvoke(function string, args ...string) []byte {
+	s.t.Helper()
+	response := s.invoke(function, args...)
+	if response.Status != shim.OK {
+		s.t.Fatalf("%s%v failed: %s", function, args, response.Message)
+	}
+	return response.Payload
+}
+
+func (s *testStub) mustFail(function string, args ...string) string {
+	s.t.Helper()
+	response := s.invoke(function, args...)
+	if response.Status == shim.OK {
+		s.t.Fatalf("%s%v should have failed", function, args)
+	}
+	return response.Message
+}
+
+func (s *testStub) start() {
+	s.tx++
+	s.MockTransactionStart(fmt.Sprintf("tx%d", s.tx))
+}
+
+func (s *testStub) end() {
+	s.MockTransactionEnd(s.TxID)
+	s.transient = nil
+}
+
+// createID creates user holding docid, its owner secret is the user name
+func (s *testStub) createID(user string, docid string) {
+	s.t.Helper()
+	s.with(TRANSIENT_FULLNAME, "Name of "+user, TRANSIENT_DOCID, docid, TRANSIENT_SECRET, user)
+	s.mustInvoke("createId", user)
+}
+
+func (s *testStub) getID(user string) ID {
+	s.t.Helper()
+	id := ID{}
+	if err := json.Unmarshal(s.State[user], &id); err != nil {
+		s.t.Fatalf("ID of %s: %s", user, err.Error())
+	}
+	return id
+}
+
+func (s *testStub) GetArgs() [][]byte { return s.args }
+
+func (s *testStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) { return s.creator, nil }
+
+func (s *testStub) GetTransient() (map[string][]byte, error) { return s.transient, nil }
+
+func (s *testStub) PutState(key string, value []byte) error {
+	if s.TxID == "" {
+		return errors.New("PutState outside of a transaction")
+	}
+	return s.MockStub.PutState(key, value)
+}
+
+// GetStateByRange leaves out composite keys and accepts an empty endKey, like the peer
+func (s *testStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return scanKeys(s.State, startKey, endKey, func(key string) bool { return !strings.HasPrefix(key, "\x00") }), nil
+}
+
+// GetStateByRangeWithPagination starts at the bookmark, the bookmark of the page is the first key after it
+func (s *testStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *sc.QueryResponseMetadata, error) {
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	it := scanKeys(s.State, startKey, endKey, func(key string) bool { return !strings.HasPrefix(key, "\x00") })
+	metadata := &sc.QueryResponseMetadata{}
+	if len(it.kvs) > int(pageSize) {
+		metadata.Bookmark = it.kvs[pageSize].Key
+		it.kvs = it.kvs[:pageSize]
+	}
+	metadata.FetchedRecordsCount = int32(len(it.kvs))
+	return it, metadata, nil
+}
+
+func (s *testStub) GetPrivateData(collection, key string) ([]byte, error) {
+	return s.private[collection+"/"+key], nil
+}
+
+func (s *testStub) PutPrivateData(collection string, key string, value []byte) error {
+	if s.TxID == "" {
+		return errors.New("PutPrivateData outside of a transaction")
+	}
+	s.private[collection+"/"+key] = value
+	return nil
+}
+
+func (s *testStub) DelPrivateData(collection, key string) error {
+	delete(s.private, collection+"/"+key)
+	return nil
+}
+
+func (s *testStub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return s.privateScan(collection, startKey, endKey), nil
+}
+
+func (s *testStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	partial, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return s.privateScan(collection, partial, partial+"\U0010FFFF"), nil
+}
+
+func (s *testStub) privateScan(collection, startKey, endKey string) *testIterator {
+	values := map[string][]byte{}
+	for key, value := range s.private {
+		if strings.HasPrefix(key, collection+"/") {
+			values[strings.TrimPrefix(key, collection+"/")] = value
+		}
+	}
+	return scanKeys(values, startKey, endKey, func(string) bool { return true })
+}
+
+// testIterator iterates over a sorted copy of the keys in range
+type testIterator struct {
+	kvs []*queryresult.KV
+}
+
+func scanKeys(values map[string][]byte, startKey, endKey string, keep func(string) bool) *testIterator {
+	keys := []string{}
+	for key := range values {
+		if key >= startKey && (endKey == "" || key < endKey) && keep(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	it := &testIterator{}
+	for _, key := range keys {
+		it.kvs = append(it.kvs, &queryresult.KV{Key: key, Value: values[key]})
+	}
+	return it
+}
+
+func (it *testIterator) HasNext() bool { return len(it.kvs) > 0 }
+
+func (it *testIterator) Close() error { return nil }
+
+func (it *testIterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("No more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+// testCreator is the serialized identity of a client of org, with the id.role attribute when role is set
+func testCreator(t *testing.T, org string, role string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "client", Organization: []string{org}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if role != "" {
+		attrs, _ := json.Marshal(map[string]map[string]string{"attrs": {ROLE_ATTR: role}})
+		template.ExtraExtensions = []pkix.Extension{{Id: attrOID, Value: attrs}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: org, IdBytes: certPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Registry of the parties of the network, attesters and relying parties, with the org (MSP id)
+ * each of them belongs to. Parties are named by the callers in the args, the registry is what
+ * ties such a name to the peers and clients of an org.
+ */
+
+// PARTY is the composite key object type of the party registry
+const PARTY = "party~name"
+
+// Party is an attester or a relying party registered by governance admins
+type Party struct {
+	Name       string      `json:"name"`
+	Org        string      `json:"org"`
+	Controller *Controller `json:"controller,omitempty"`
+	Registered int64       `json:"registered"`
+	TxID       string      `json:"txId"`
+}
+
+// Controller are the details of a relying party that consent receipts name as the PII controller
+type Controller struct {
+	Contact   string            `json:"contact"`
+	Address   map[string]string `json:"address,omitempty"`
+	Email     string            `json:"email"`
+	Phone     string            `json:"phone,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	PolicyURL string            `json:"policyUrl"`
+	Language  string            `json:"language,omitempty"`
+}
+
+/*
+ * REGISTER PARTY (governance admins only), the attester_<id> bucket of an attester is created
+ * restricted to the peers of its org. Relying parties give their controller details, they end up in the
+ * consent receipts of the claims shared with them. Receipts of relying parties registered without
+ * them, or not registered at all, only name the relying party.
+ * args: 0 => (attester or relying party id), 1 => (MSP id of its org),
+ *       optional 2 => (controller, JSON object {"contact", "address", "email", "phone", "url", "policyUrl", "language"})
+ */
+func (s *SmartContract) registerParty(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("registerParty", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[0] == "" || args[1] == "" {
+		return shim.Error("The party and its org must not be empty")
+	}
+	party := Party{Name: args[0], Org: args[1], TxID: APIstub.GetTxID()}
+	if optionalArg(args, 2) != "" {
+		party.Controller = &Controller{}
+		if err := strictUnmarshal([]byte(args[2]), party.Controller); err != nil {
+			return shim.Error("Invalid controller: " + err.Error())
+		}
+		if party.Controller.Contact == "" || party.Controller.Email == "" || party.Controller.PolicyURL == "" {
+			return shim.Error("The controller needs a contact, an email and a policyUrl")
+		}
+	}
+	registered, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	party.Registered = registered
+	key, err := APIstub.CreateCompositeKey(PARTY, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	partyAsBytes, _ := json.Marshal(party)
+	if err := APIstub.PutState(key, partyAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// the bucket is created with the policy of the registered org, so that no attestation is ever
+	// written without its endorsement, and an existing bucket moves to the registered org
+	bucketAsBytes, err := APIstub.GetState(ATTEST + args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if bucketAsBytes == nil {
+		if err := putAttestClaim(APIstub, ATTEST+args[0], AttestClaim{Claim: make(map[string]map[string]string)}); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := setKeyOrgs(APIstub, ATTEST+args[0], []string{args[1]}); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * QUERY PARTY
+ * args: 0 => (attester or relying party id)
+ */
+func (s *SmartContract) queryParty(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryParty", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	party, err := getParty(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	partyAsBytes, _ := json.Marshal(party)
+	return shim.Success(partyAsBytes)
+}
+
+// getParty returns the registered party, an error when governance did not register it
+func getParty(APIstub shim.ChaincodeStubInterface, name string) (Party, error) {
+	party, err := findParty(APIstub, name)
+	if err != nil {
+		return Party{}, err
+	}
+	if party == nil {
+		return Party{}, fmt.Errorf("%s is not a registered party", name)
+	}
+	return *party, nil
+}
+
+// findParty returns the registered party, nil when governance did not register it
+func findParty(APIstub shim.ChaincodeStubInterface, name string) (*Party, error) {
+	key, err := APIstub.CreateCompositeKey(PARTY, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	partyAsBytes, err := APIstub.GetState(key)
+	if err != nil || partyAsBytes == nil {
+		return nil, err
+	}
+	party := Party{}
+	if err := json.Unmarshal(partyAsBytes, &party); err != nil {
+		return nil, err
+	}
+	return &party, nil
+}
+
+/*
+ * callerParty checks that the creator of the transaction is a client of the org of the registered
+ * party name, and returns its MSP id and client id
+ */
+func callerParty(APIstub shim.ChaincodeStubInterface, name string) (string, string, error) {
+	party, err := getParty(APIstub, name)
+	if err != nil {
+		return "", "", err
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return "", "", err
+	}
+	if org != party.Org {
+		return "", "", fmt.Errorf("Only clients of %s can act as %s", party.Org, name)
+	}
+	caller, err := cid.GetID(APIstub)
+	return org, caller, err
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * The pseudonyms a user has towards relying parties are mapped back to the user in the private
+ * data collection only, world state never holds a pseudonym next to the user key.
+ */
+
+// Composite key object types of the private mappings between pseudonyms and users
+const (
+	PSEUDONYM      = "pseudonym~relyingParty~pseudonym"
+	PSEUDONYM_USER = "pseudonymUser~user~relyingParty"
+)
+
+// TRANSIENT_SECRET is the transient map key carrying the user's pseudonym secret,
+// so that the secret is never written to a block
+const TRANSIENT_SECRET = "secret"
+
+/*
+ * pairwisePseudonym derives the identifier the user has towards relyingParty.
+ * The same secret and relying party always give the same pseudonym, different relying
+ * parties get identifiers that cannot be correlated without the secret.
+ */
+func pairwisePseudonym(secret []byte, relyingParty string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(relyingParty))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// transientSecret returns the pseudonym secret of the transaction, nil when none was given
+func transientSecret(APIstub shim.ChaincodeStubInterface) ([]byte, error) {
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := transient[TRANSIENT_SECRET]
+	if !ok {
+		return nil, nil
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("The pseudonym secret must not be empty")
+	}
+	return secret, nil
+}
+
+// ownerSecretHash is what the ID record keeps of the secret of its owner
+func ownerSecretHash(user string, secret []byte) string {
+	h := sha256.Sum256(append([]byte(user+":"), secret...))
+	return hex.EncodeToString(h[:])
+}
+
+/*
+ * checkSecret only accepts the secret the user was created with, identities created without
+ * a secret have no owner that can prove itself
+ */
+func checkSecret(user string, id ID, secret []byte) error {
+	if id.SecretHash == "" {
+		return fmt.Errorf("%s has no owner secret, it is set when the identity is created or imported, or by setOwnerSecret", user)
+	}
+	if !hmac.Equal([]byte(id.SecretHash), []byte(ownerSecretHash(user, secret))) {
+		return fmt.Errorf("Wrong pseudonym secret")
+	}
+	return nil
+}
+
+/*
+ * registerPseudonym records the pseudonym of the user towards relyingParty and returns it
+ */
+func registerPseudonym(APIstub shim.ChaincodeStubInterface, user string, id ID, relyingParty string, secret []byte) (string, error) {
+	if err := checkSecret(user, id, secret); err != nil {
+		return "", err
+	}
+	pseudonym := pairwisePseudonym(secret, relyingParty)
+	return pseudonym, putPseudonym(APIstub, user, relyingParty, pseudonym)
+}
+
+// putPseudonym maps the pseudonym relyingParty knows to the user, and the user back to it
+func putPseudonym(APIstub shim.ChaincodeStubInterface, user string, relyingParty string, pseudonym string) error {
+	key, err := APIstub.CreateCompositeKey(PSEUDONYM, []string{relyingParty, pseudonym})
+	if err != nil {
+		return err
+	}
+	if err := APIstub.PutPrivateData(PRIVATE_COLLECTION, key, []byte(user)); err != nil {
+		return err
+	}
+	userKey, err := APIstub.CreateCompositeKey(PSEUDONYM_USER, []string{user, relyingParty})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutPrivateData(PRIVATE_COLLECTION, userKey, []byte(pseudonym))
+}
+
+/*
+ * movePseudonym makes the pseudonym user has towards relyingParty resolve to survivor, nothing
+ * is done when the user has none. A survivor with a pseudonym of its own keeps it as the one
+ * it maps back to.
+ */
+func movePseudonym(APIstub shim.ChaincodeStubInterface, user string, survivor string, relyingParty string) error {
+	userKey, err := APIstub.CreateCompositeKey(PSEUDONYM_USER, []string{user, relyingParty})
+	if err != nil {
+		return err
+	}
+	pseudonym, err := APIstub.GetPrivateData(PRIVATE_COLLECTION, userKey)
+	if err != nil || pseudonym == nil {
+		return err
+	}
+	if err := APIstub.DelPrivateData(PRIVATE_COLLECTION, userKey); err != nil {
+		return err
+	}
+	survivorKey, err := APIstub.CreateCompositeKey(PSEUDONYM_USER, []string{survivor, relyingParty})
+	if err != nil {
+		return err
+	}
+	own, err := APIstub.GetPrivateData(PRIVATE_COLLECTION, survivorKey)
+	if err != nil {
+		return err
+	}
+	if own == nil {
+		return putPseudonym(APIstub, survivor, relyingParty, string(pseudonym))
+	}
+	key, err := APIstub.CreateCompositeKey(PSEUDONYM, []string{relyingParty, string(pseudonym)})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutPrivateData(PRIVATE_COLLECTION, key, []byte(survivor))
+}
+
+/*
+ * movePublicPseudonyms moves the pseudonyms earlier versions mapped in world state to the
+ * private data collection
+ */
+func movePublicPseudonyms(APIstub shim.ChaincodeStubInterface) error {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(PSEUDONYM, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		if err := putPseudonym(APIstub, string(queryResponse.Value), keyParts[0], keyParts[1]); err != nil {
+			return err
+		}
+		if err := APIstub.DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * resolveUser returns the user key behind the pseudonym relyingParty knows, or the
+ * identifier itself when it is not a pseudonym of that relying party
+ */
+func resolveUser(APIstub shim.ChaincodeStubInterface, identifier string, relyingParty string) (string, error) {
+	key, err := APIstub.CreateCompositeKey(PSEUDONYM, []string{relyingParty, identifier})
+	if err != nil {
+		return "", err
+	}
+	user, err := APIstub.GetPrivateData(PRIVATE_COLLECTION, key)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return identifier, nil
+	}
+	return string(user), nil
+}
+
+/*
+ * RESOLVE PSEUDONYM, only the owner knowing the secret (transient "secret") can map it back
+ * args: 0 => (pseudonym), 1 => (relyingParty)
+ */
+func (s *SmartContract) resolvePseudonym(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("resolvePseudonym", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	secret, err := transientSecret(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if secret == nil || pairwisePseudonym(secret, args[1]) != args[0] {
+		return shim.Error("Pseudonym not Found!")
+	}
+
+	user, err := resolveUser(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if user == args[0] {
+		return shim.Error("Pseudonym not Found!")
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkSecret(user, id, secret); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(user))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolvePseudonymAsOwner(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1", TRANSIENT_SECRET, "alice")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email", "10")
+	pseudonym := pairwisePseudonym([]byte("alice"), "rp")
+	if pseudonym == pairwisePseudonym([]byte("alice"), "other") {
+		t.Errorf("two relying parties got the same pseudonym")
+	}
+	for key := range stub.State {
+		if strings.Contains(key, pseudonym) {
+			t.Errorf("the pseudonym is in world state under %q", key)
+		}
+	}
+
+	stub.mustFail("resolvePseudonym", pseudonym, "rp")
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("resolvePseudonym", pseudonym, "rp")
+	stub.with(TRANSIENT_SECRET, "alice")
+	stub.mustFail("resolvePseudonym", pseudonym, "other")
+	stub.with(TRANSIENT_SECRET, "alice")
+	if user := string(stub.mustInvoke("resolvePseudonym", pseudonym, "rp")); user != "alice" {
+		t.Errorf("the pseudonym resolves to %s", user)
+	}
+}
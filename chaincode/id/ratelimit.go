@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Rate limits of requestAttestation, so no one can flood the pending requests of an attester.
+ * A requester (the certificate that signs the proposal, whatever idClient it names) may make
+ * MaxRequests requests to an attester per window and must wait Cooldown seconds between two
+ * of them; times are transaction timestamps. Beyond the quota a request locks Deposit from the
+ * requester's deposit balance: it is refunded when the attester attests the claim and forfeited
+ * when the attester rejects it.
+ */
+
+// Composite key prefixes of the rate limits
+const (
+	RATE_LIMIT   = "rateLimit~attester"
+	REQUEST_LOG  = "attestRequestLog~attester~requester~timestamp~txId"
+	DEPOSIT      = "deposit~requester"
+	DEPOSIT_LOCK = "depositLock~attester~user~claim"
+)
+
+// ANY_ATTESTER is the attester of the default rate limit
+const ANY_ATTESTER = "*"
+
+// RateLimit limits the requests of every requester to an attester, zero values disable a limit
+type RateLimit struct {
+	MaxRequests int   `json:"maxRequests"`
+	Window      int64 `json:"window"`
+	Cooldown    int64 `json:"cooldown"`
+	Deposit     int64 `json:"deposit"`
+}
+
+// DepositLock is the deposit locked by a request beyond the quota
+type DepositLock struct {
+	Requester string `json:"requester"`
+	Amount    int64  `json:"amount"`
+	TxID      string `json:"txId"`
+}
+
+// requesterID identifies the creator of the transaction
+func requesterID(APIstub shim.ChaincodeStubInterface) (string, error) {
+	id, err := cid.GetID(APIstub)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(h[:16]), nil
+}
+
+/*
+ * SET RATE LIMIT (governance admins only)
+ * args: 0 => (idAttester, * for the default of all attesters), 1 => (maxRequests per window),
+ *       2 => (window, seconds), 3 => (cooldown between requests, seconds), 4 => (deposit per request beyond the quota)
+ */
+func (s *SmartContract) setRateLimit(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("setRateLimit", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	numbers := make([]int64, 4)
+	for i := range numbers {
+		number, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || number < 0 {
+			return shim.Error("Rate limits must be positive numbers")
+		}
+		numbers[i] = number
+	}
+	limit := RateLimit{MaxRequests: int(numbers[0]), Window: numbers[1], Cooldown: numbers[2], Deposit: numbers[3]}
+	if limit.MaxRequests > 0 && limit.Window == 0 {
+		return shim.Error("A quota needs a window")
+	}
+	key, err := APIstub.CreateCompositeKey(RATE_LIMIT, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	limitAsBytes, _ := json.Marshal(limit)
+	if err := APIstub.PutState(key, limitAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * QUERY RATE LIMIT that applies to an attester
+ * args: 0 => (idAttester)
+ */
+func (s *SmartContract) queryRateLimit(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryRateLimit", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	limit, err := getRateLimit(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	limitAsBytes, _ := json.Marshal(limit)
+	return shim.Success(limitAsBytes)
+}
+
+/*
+ * CREDIT DEPOSIT (governance admins only), once the requester paid a deposit off-chain
+ * args: 0 => (requester, as returned by queryDeposit), 1 => (amount)
+ */
+func (s *SmartContract) creditDeposit(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("creditDeposit", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		return shim.Error("amount must be a positive number")
+	}
+	balance, err := depositBalance(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putDepositBalance(APIstub, args[0], balance+amount); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * QUERY DEPOSIT, the requester id and deposit balance of the caller
+ * args: none
+ */
+func (s *SmartContract) queryDeposit(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryDeposit", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	requester, err := requesterID(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	balance, err := depositBalance(APIstub, requester)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	depositAsBytes, _ := json.Marshal(map[string]interface{}{"requester": requester, "balance": balance})
+	return shim.Success(depositAsBytes)
+}
+
+/*
+ * limitAttestationRequest enforces the rate limit of the attester on the creator of the
+ * transaction and logs the request
+ */
+func limitAttestationRequest(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) error {
+	limit, err := getRateLimit(APIstub, attester)
+	if err != nil {
+		return err
+	}
+	requester, err := requesterID(APIstub)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(REQUEST_LOG, []string{attester, requester})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	inWindow := 0
+	var last int64
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		requested, err := strconv.ParseInt(keyParts[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		if requested > last {
+			last = requested
+		}
+		if requested > now-limit.Window {
+			inWindow++
+		} else if requested <= now-limit.Cooldown {
+			// out of the window and the cooldown, the row is no longer needed
+			if err := APIstub.DelState(queryResponse.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	if limit.Cooldown > 0 && last != 0 && now < last+limit.Cooldown {
+		return fmt.Errorf("Too many requests to %s, retry in %d seconds", attester, last+limit.Cooldown-now)
+	}
+	if limit.MaxRequests > 0 && inWindow >= limit.MaxRequests {
+		if limit.Deposit == 0 {
+			return fmt.Errorf("Quota of %d requests to %s per %d seconds exceeded", limit.MaxRequests, attester, limit.Window)
+		}
+		if err := lockDeposit(APIstub, requester, limit.Deposit, attester, user, claim); err != nil {
+			return err
+		}
+	}
+
+	// the timestamp is zero padded so the rows of a requester sort by time
+	key, err := APIstub.CreateCompositeKey(REQUEST_LOG, []string{attester, requester, fmt.Sprintf("%020d", now), APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte{0x00})
+}
+
+func lockDeposit(APIstub shim.ChaincodeStubInterface, requester string, amount int64, attester string, user string, claim string) error {
+	balance, err := depositBalance(APIstub, requester)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return fmt.Errorf("Quota exceeded, a deposit of %d is required beyond it and the balance is %d", amount, balance)
+	}
+	key, err := APIstub.CreateCompositeKey(DEPOSIT_LOCK, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	previous, err := APIstub.GetState(key)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		return fmt.Errorf("A deposit is already locked for this request")
+	}
+	if err := putDepositBalance(APIstub, requester, balance-amount); err != nil {
+		return err
+	}
+	lockAsBytes, _ := json.Marshal(DepositLock{Requester: requester, Amount: amount, TxID: APIstub.GetTxID()})
+	return APIstub.PutState(key, lockAsBytes)
+}
+
+/*
+ * releaseDeposit ends the deposit lock of a request, the deposit goes back to the requester when
+ * refund is set and is forfeited otherwise
+ */
+func releaseDeposit(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string, refund bool) error {
+	key, err := APIstub.CreateCompositeKey(DEPOSIT_LOCK, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	lockAsBytes, err := APIstub.GetState(key)
+	if err != nil || lockAsBytes == nil {
+		return err
+	}
+	lock := DepositLock{}
+	if err := json.Unmarshal(lockAsBytes, &lock); err != nil {
+		return err
+	}
+	if err := APIstub.DelState(key); err != nil {
+		return err
+	}
+	if !refund {
+		return nil
+	}
+	balance, err := depositBalance(APIstub, lock.Requester)
+	if err != nil {
+		return err
+	}
+	return putDepositBalance(APIstub, lock.Requester, balance+lock.Amount)
+}
+
+// getRateLimit returns the rate limit of the attester, the default one when it has none
+func getRateLimit(APIstub shim.ChaincodeStubInterface, attester string) (RateLimit, error) {
+	limit := RateLimit{}
+	for _, target := range []string{attester, ANY_ATTESTER} {
+		key, err := APIstub.CreateCompositeKey(RATE_LIMIT, []string{target})
+		if err != nil {
+			return limit, err
+		}
+		limitAsBytes, err := APIstub.GetState(key)
+		if err != nil {
+			return limit, err
+		}
+		if limitAsBytes != nil {
+			err := json.Unmarshal(limitAsBytes, &limit)
+			return limit, err
+		}
+	}
+	return limit, nil
+}
+
+func depositBalance(APIstub shim.ChaincodeStubInterface, requester string) (int64, error) {
+	key, err := APIstub.CreateCompositeKey(DEPOSIT, []string{requester})
+	if err != nil {
+		return 0, err
+	}
+	balanceAsBytes, err := APIstub.GetState(key)
+	if err != nil || balanceAsBytes == nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(balanceAsBytes), 10, 64)
+}
+
+func putDepositBalance(APIstub shim.ChaincodeStubInterface, requester string, balance int64) error {
+	key, err := APIstub.CreateCompositeKey(DEPOSIT, []string{requester})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte(strconv.FormatInt(balance, 10)))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type depositBalanceResult struct {
+	Requester string `json:"requester"`
+	Balance   int64  `json:"balance"`
+}
+
+func queryDepositOf(t *testing.T, stub *testStub) depositBalanceResult {
+	t.Helper()
+	deposit := depositBalanceResult{}
+	if err := json.Unmarshal(stub.mustInvoke("queryDeposit"), &deposit); err != nil {
+		t.Fatal(err)
+	}
+	return deposit
+}
+
+func TestRateLimitQuotaAndCooldown(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setRateLimit", ANY_ATTESTER, "1", "3600", "0", "0")
+	if message := stub.mustFail("setRateLimit", "acme", "1", "0", "0", "0"); message != "A quota needs a window" {
+		t.Errorf("unexpected error %s", message)
+	}
+	limit := RateLimit{}
+	if err := json.Unmarshal(stub.mustInvoke("queryRateLimit", "acme"), &limit); err != nil {
+		t.Fatal(err)
+	}
+	if limit.MaxRequests != 1 || limit.Window != 3600 {
+		t.Errorf("the default limit does not apply: %+v", limit)
+	}
+
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url")
+	if message := stub.mustFail("requestAttestation", "acme", "alice", "docid", "url"); message != "Quota of 1 requests to acme per 3600 seconds exceeded" {
+		t.Errorf("a request beyond the quota was accepted: %s", message)
+	}
+
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setRateLimit", "acme", "0", "0", "3600", "0")
+	stub.as(TEST_ORG, "")
+	if message := stub.mustFail("requestAttestation", "acme", "alice", "docid", "url"); !strings.HasPrefix(message, "Too many requests to acme, retry in") {
+		t.Errorf("a request within the cooldown was accepted: %s", message)
+	}
+}
+
+func TestRateLimitDeposit(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.createID("bob", "P2")
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setRateLimit", "acme", "1", "3600", "0", "10")
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url")
+	if message := stub.mustFail("requestAttestation", "acme", "alice", "docid", "url"); message != "Quota exceeded, a deposit of 10 is required beyond it and the balance is 0" {
+		t.Errorf("unexpected error %s", message)
+	}
+
+	requester := queryDepositOf(t, stub).Requester
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("creditDeposit", requester, "25")
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "docid", "url")
+	stub.mustInvoke("requestAttestation", "acme", "bob", "fullname", "url")
+	if balance := queryDepositOf(t, stub).Balance; balance != 5 {
+		t.Fatalf("the deposits were not locked, the balance is %d", balance)
+	}
+
+	// an attested request gets its deposit back, a rejected one forfeits it
+	stub.mustInvoke("createAttestation", "acme", "alice", "docid", "hash")
+	stub.mustInvoke("rejectAttestation", "acme", "bob", "fullname")
+	if balance := queryDepositOf(t, stub).Balance; balance != 15 {
+		t.Errorf("unexpected balance %d", balance)
+	}
+	if countRows(stub, DEPOSIT_LOCK) != 0 {
+		t.Errorf("a deposit lock was kept")
+	}
+}
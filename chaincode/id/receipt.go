@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Composite key object types of the consent receipts and their lookup indexes
+const (
+	RECEIPT       = "consentReceipt~receiptId"
+	RECEIPT_USER  = "consentReceiptUser~user~receiptId"
+	RECEIPT_PARTY = "consentReceiptParty~relyingParty~receiptId"
+)
+
+// RECEIPT_VERSION is the Kantara Initiative consent receipt specification the receipts follow
+const RECEIPT_VERSION = "KI-CR-v1.1.0"
+
+// RECEIPT_LANGUAGE is the language of receipts of relying parties that registered none
+const RECEIPT_LANGUAGE = "en"
+
+// ConsentReceipt is a Kantara Initiative consent receipt issued every time a user shares claims
+type ConsentReceipt struct {
+	Version          string          `json:"version"`
+	Jurisdiction     string          `json:"jurisdiction"`
+	ConsentTimestamp int64           `json:"consentTimestamp"`
+	CollectionMethod string          `json:"collectionMethod"`
+	ConsentReceiptID string          `json:"consentReceiptID"`
+	Language         string          `json:"language"`
+	PiiPrincipalID   string          `json:"piiPrincipalId"`
+	PiiControllers   []PiiController `json:"piiControllers"`
+	PolicyURL        string          `json:"policyUrl"`
+	Services         []Service       `json:"services"`
+	Sensitive        bool            `json:"sensitive"`
+	SpiCat           []string        `json:"spiCat"`
+}
+
+// PiiController is the party receiving the shared claims
+type PiiController struct {
+	PiiController    string            `json:"piiController"`
+	OnBehalf         bool              `json:"onBehalf"`
+	Contact          string            `json:"contact"`
+	Address          map[string]string `json:"address,omitempty"`
+	Email            string            `json:"email"`
+	Phone            string            `json:"phone,omitempty"`
+	PiiControllerURL string            `json:"piiControllerUrl,omitempty"`
+}
+
+type Service struct {
+	Service  string    `json:"service"`
+	Purposes []Purpose `json:"purposes"`
+}
+
+type Purpose struct {
+	Purpose              string   `json:"purpose"`
+	ConsentType          string   `json:"consentType"`
+	PiiCategory          []string `json:"piiCategory"`
+	PrimaryPurpose       bool     `json:"primaryPurpose"`
+	Termination          string   `json:"termination"`
+	ThirdPartyDisclosure bool     `json:"thirdPartyDisclosure"`
+}
+
+/*
+ * issueConsentReceipt records the receipt of claims shared with relyingParty in this transaction.
+ * The receipt names the user by the pairwise pseudonym, when there is one, and then lives in the
+ * private data collection with the index of the receipts of the user: the transaction also writes
+ * the ID record, a public receipt would tie the pseudonym to it. The controller details are
+ * those the relying party was registered with, see registerParty, receipts of relying parties
+ * registered without them only name the relying party.
+ */
+func issueConsentReceipt(APIstub shim.ChaincodeStubInterface, user string, pseudonym string, relyingParty string, claims []string,
+	purpose string, validDays int, jurisdiction string, method string) (ConsentReceipt, error) {
+
+	principal := user
+	if pseudonym != "" {
+		principal = pseudonym
+	}
+	controller := Controller{}
+	party, err := findParty(APIstub, relyingParty)
+	if err != nil {
+		return ConsentReceipt{}, err
+	}
+	if party != nil && party.Controller != nil {
+		controller = *party.Controller
+	}
+	language := controller.Language
+	if language == "" {
+		language = RECEIPT_LANGUAGE
+	}
+
+	consentTimestamp, err := txTime(APIstub)
+	if err != nil {
+		return ConsentReceipt{}, err
+	}
+	receipt := ConsentReceipt{
+		Version:          RECEIPT_VERSION,
+		Jurisdiction:     jurisdiction,
+		ConsentTimestamp: consentTimestamp,
+		CollectionMethod: method,
+		ConsentReceiptID: receiptID(APIstub.GetTxID()),
+		Language:         language,
+		PiiPrincipalID:   principal,
+		PiiControllers: []PiiController{{
+			PiiController:    relyingParty,
+			Contact:          controller.Contact,
+			Address:          controller.Address,
+			Email:            controller.Email,
+			Phone:            controller.Phone,
+			PiiControllerURL: controller.URL,
+		}},
+		PolicyURL: controller.PolicyURL,
+		Services: []Service{{
+			Service: relyingParty,
+			Purposes: []Purpose{{
+				Purpose:        purpose,
+				ConsentType:    "EXPLICIT",
+				PiiCategory:    claims,
+				PrimaryPurpose: true,
+				Termination:    fmt.Sprintf("P%dD", validDays),
+			}},
+		}},
+		SpiCat: []string{},
+	}
+	// claims registered as highly sensitive are special categories of personal information
+	for _, claim := range claims {
+		schema, err := getClaimSchema(APIstub, claim)
+		if err != nil {
+			return receipt, err
+		}
+		if schema.Sensitivity == SENSITIVITY_HIGH {
+			receipt.Sensitive = true
+			receipt.SpiCat = append(receipt.SpiCat, claim)
+		}
+	}
+
+	receiptKey, err := APIstub.CreateCompositeKey(RECEIPT, []string{receipt.ConsentReceiptID})
+	if err != nil {
+		return receipt, err
+	}
+	userKey, err := APIstub.CreateCompositeKey(RECEIPT_USER, []string{user, receipt.ConsentReceiptID})
+	if err != nil {
+		return receipt, err
+	}
+	receiptAsBytes, _ := json.Marshal(receipt)
+	// save the receipt with the index used to list the receipts of a user
+	if pseudonym != "" {
+		if err := APIstub.PutPrivateData(PRIVATE_COLLECTION, receiptKey, receiptAsBytes); err != nil {
+			return receipt, err
+		}
+		err = APIstub.PutPrivateData(PRIVATE_COLLECTION, userKey, []byte{0x00})
+	} else {
+		if err := APIstub.PutState(receiptKey, receiptAsBytes); err != nil {
+			return receipt, err
+		}
+		err = APIstub.PutState(userKey, []byte{0x00})
+	}
+	if err != nil {
+		return receipt, err
+	}
+	// and the one of the relying party, it only holds the receipt id
+	partyKey, err := APIstub.CreateCompositeKey(RECEIPT_PARTY, []string{relyingParty, receipt.ConsentReceiptID})
+	if err != nil {
+		return receipt, err
+	}
+	if err := APIstub.PutState(partyKey, []byte{0x00}); err != nil {
+		return receipt, err
+	}
+	return receipt, nil
+}
+
+// receiptID formats the hash of the transaction id as a UUID
+func receiptID(txID string) string {
+	h := sha256.Sum256([]byte(txID))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+/*
+ * QUERY CONSENT RECEIPT
+ * args: 0 => (receiptId)
+ */
+func (s *SmartContract) queryConsentReceipt(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryConsentReceipt", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	receiptAsBytes, err := getConsentReceipt(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(receiptAsBytes)
+}
+
+/*
+ * QUERY ALL CONSENT RECEIPTS OF A USER. The receipts issued under a pseudonym are only listed
+ * when the owner's secret is sent in the transient map ("secret").
+ * args: 0 => (idClient)
+ */
+func (s *SmartContract) queryReceiptsByUser(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryReceiptsByUser", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	owner, err := ownerQuery(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(RECEIPT_USER, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	if !owner {
+		return listConsentReceipts(APIstub, resultsIterator)
+	}
+	// receipts under a pseudonym are indexed in the private data collection
+	privateIterator, err := APIstub.GetPrivateDataByPartialCompositeKey(PRIVATE_COLLECTION, RECEIPT_USER, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer privateIterator.Close()
+	return listConsentReceipts(APIstub, resultsIterator, privateIterator)
+}
+
+/*
+ * QUERY ALL CONSENT RECEIPTS OF A RELYING PARTY
+ * args: 0 => (relyingParty)
+ */
+func (s *SmartContract) queryReceiptsByRelyingParty(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryReceiptsByRelyingParty", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(RECEIPT_PARTY, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+	return listConsentReceipts(APIstub, resultsIterator)
+}
+
+// listConsentReceipts returns the receipts of the index entries as a JSON array
+func listConsentReceipts(APIstub shim.ChaincodeStubInterface, indexes ...shim.StateQueryIteratorInterface) sc.Response {
+	// buffer is a JSON array containing the receipts
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	first := true
+	for _, resultsIterator := range indexes {
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			receiptAsBytes, err := getConsentReceipt(APIstub, keyParts[1])
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if !first {
+				buffer.WriteString(", ")
+			}
+			buffer.Write(receiptAsBytes)
+			first = false
+		}
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
+// getConsentReceipt reads the receipt from world state, or from the private data collection when it was issued under a pseudonym
+func getConsentReceipt(APIstub shim.ChaincodeStubInterface, id string) ([]byte, error) {
+	receiptKey, err := APIstub.CreateCompositeKey(RECEIPT, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	receiptAsBytes, err := APIstub.GetState(receiptKey)
+	if err != nil {
+		return nil, err
+	}
+	if receiptAsBytes == nil {
+		receiptAsBytes, err = APIstub.GetPrivateData(PRIVATE_COLLECTION, receiptKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if receiptAsBytes == nil {
+		return nil, fmt.Errorf("Consent receipt not Found!")
+	}
+	return receiptAsBytes, nil
+}
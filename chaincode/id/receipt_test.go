@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReceiptNamesController(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1")
+	receipt := queryReceipt(t, stub, string(stub.mustInvoke("shareinfo", "alice", "rp", "email")))
+	controller := receipt.PiiControllers[0]
+	if controller.PiiController != "rp" || controller.Contact != "DPO" || controller.Email != "dpo@rp" || receipt.PolicyURL != "https://rp/policy" {
+		t.Errorf("the receipt does not name the controller of rp: %+v", receipt)
+	}
+}
+
+func TestReceiptWithoutController(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "bank", TEST_ORG)
+	stub.as(TEST_ORG, "")
+
+	// GOOGLE is a relying party of the baseline that was never registered
+	for _, rp := range []string{"bank", "GOOGLE"} {
+		stub.with(TRANSIENT_TOKEN, "t-"+rp)
+		receipt := queryReceipt(t, stub, string(stub.mustInvoke("shareinfo", "alice", rp, "email")))
+		controller := receipt.PiiControllers[0]
+		if controller.PiiController != rp || controller.Contact != "" || receipt.PolicyURL != "" || receipt.Language != RECEIPT_LANGUAGE {
+			t.Errorf("unexpected receipt for %s: %+v", rp, receipt)
+		}
+	}
+}
+
+func TestRegisterPartyRejectsUnknownControllerFields(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	message := stub.mustFail("registerParty", "rp", TEST_ORG, `{"contact": "DPO", "email": "dpo@rp", "policyUrl": "https://rp/policy", "fax": "1"}`)
+	if !strings.HasPrefix(message, "Invalid controller") {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.mustInvoke("registerParty", "rp", TEST_ORG, TEST_CONTROLLER)
+}
+
+func TestPseudonymousReceiptIsPrivate(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+	stub.with(TRANSIENT_TOKEN, "t2", TRANSIENT_SECRET, "alice")
+	receiptID := string(stub.mustInvoke("shareinfo", "alice", "rp", "fullname", "10"))
+	pseudonym := pairwisePseudonym([]byte("alice"), "rp")
+
+	for key, value := range stub.State {
+		if strings.Contains(string(value), pseudonym) || strings.Contains(key, pseudonym) {
+			t.Errorf("world state holds the pseudonym in %q", key)
+		}
+	}
+	if receipt := queryReceipt(t, stub, receiptID); receipt.PiiPrincipalID != pseudonym {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+
+	queryReceipts := func(pairs ...string) []ConsentReceipt {
+		stub.with(pairs...)
+		receipts := []ConsentReceipt{}
+		if err := json.Unmarshal(stub.mustInvoke("queryReceiptsByUser", "alice"), &receipts); err != nil {
+			t.Fatal(err)
+		}
+		return receipts
+	}
+	if receipts := queryReceipts(); len(receipts) != 1 || receipts[0].PiiPrincipalID != "alice" {
+		t.Errorf("pseudonymous receipts were listed without the secret: %+v", receipts)
+	}
+	if receipts := queryReceipts(TRANSIENT_SECRET, "alice"); len(receipts) != 2 {
+		t.Errorf("unexpected receipts %+v", receipts)
+	}
+	stub.with(TRANSIENT_SECRET, "bob")
+	stub.mustFail("queryReceiptsByUser", "alice")
+
+	receipts := []ConsentReceipt{}
+	if err := json.Unmarshal(stub.mustInvoke("queryReceiptsByRelyingParty", "rp"), &receipts); err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 {
+		t.Errorf("the relying party does not see its receipts: %+v", receipts)
+	}
+}
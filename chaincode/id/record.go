@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ID_VERSION is the schema version of the ID and AttestClaim records written by this chaincode.
+// Bump it together with a new entry in migrations when the JSON shape of a record changes.
+const ID_VERSION = 4
+
+/*
+ * decode the ID record stored under key, migrating it in memory when it was written by an older chaincode
+ */
+func decodeID(key string, idAsBytes []byte) (ID, error) {
+	id := ID{}
+	recordAsBytes, err := migrateRecord(RECORD_ID, key, idAsBytes)
+	if err != nil {
+		return id, err
+	}
+	if err := strictUnmarshal(recordAsBytes, &id); err != nil {
+		return id, fmt.Errorf("Corrupted ID record: %s", err.Error())
+	}
+	if id.Claims == nil {
+		id.Claims = make(map[string]Claim)
+	}
+	if id.Infoshared == nil {
+		id.Infoshared = make(map[string]map[string]Credential)
+	}
+	return id, nil
+}
+
+/*
+ * decode the attestation (or attestation request) document stored under key, migrating it in memory when needed
+ */
+func decodeAttestClaim(key string, claimAsBytes []byte) (AttestClaim, error) {
+	attest := AttestClaim{}
+	recordAsBytes, err := migrateRecord(RECORD_ATTEST, key, claimAsBytes)
+	if err != nil {
+		return attest, err
+	}
+	if err := strictUnmarshal(recordAsBytes, &attest); err != nil {
+		return attest, fmt.Errorf("Corrupted attestation record: %s", err.Error())
+	}
+	if attest.Claim == nil {
+		attest.Claim = make(map[string]map[string]string)
+	}
+	return attest, nil
+}
+
+// strictUnmarshal fails on unknown fields instead of silently dropping them
+func strictUnmarshal(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+/*
+ * get the ID stored under key, returns an error when the user does not exist or was merged into another one
+ */
+func getID(APIstub shim.ChaincodeStubInterface, key string) (ID, error) {
+	idAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return ID{}, err
+	}
+	if idAsBytes == nil {
+		return ID{}, fmt.Errorf("User not exist! :(")
+	}
+	id, err := decodeID(key, idAsBytes)
+	if err == nil && id.RedirectTo != "" {
+		return id, fmt.Errorf("User %s was merged into %s", key, id.RedirectTo)
+	}
+	return id, err
+}
+
+func putID(APIstub shim.ChaincodeStubInterface, key string, id ID) error {
+	id.Version = ID_VERSION
+	idAsBytes, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, idAsBytes)
+}
+
+/*
+ * get the attestation document stored under key, an empty one when it does not exist yet
+ */
+func getAttestClaim(APIstub shim.ChaincodeStubInterface, key string) (AttestClaim, error) {
+	claimAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return AttestClaim{}, err
+	}
+	if claimAsBytes == nil {
+		return AttestClaim{Claim: make(map[string]map[string]string)}, nil
+	}
+	return decodeAttestClaim(key, claimAsBytes)
+}
+
+func putAttestClaim(APIstub shim.ChaincodeStubInterface, key string, attest AttestClaim) error {
+	attest.Version = ID_VERSION
+	claimAsBytes, err := json.Marshal(attest)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, claimAsBytes)
+}
+
+// txTime returns the transaction timestamp in unix seconds, the same on every endorser
+func txTime(APIstub shim.ChaincodeStubInterface) (int64, error) {
+	timestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return 0, err
+	}
+	return timestamp.Seconds, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrictUnmarshal(t *testing.T) {
+	state := MigrationState{}
+	if err := strictUnmarshal([]byte(`{"version": 4, "cursor": "a", "migrated": 1, "done": true}`), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state != (MigrationState{Version: 4, Cursor: "a", Migrated: 1, Done: true}) {
+		t.Errorf("unexpected state %+v", state)
+	}
+	err := strictUnmarshal([]byte(`{"version": 4, "batch": 10}`), &MigrationState{})
+	if err == nil || !strings.Contains(err.Error(), `unknown field "batch"`) {
+		t.Errorf("an unknown field was accepted: %v", err)
+	}
+}
+
+func TestDecodeIDRejectsUnknownFields(t *testing.T) {
+	if _, err := decodeID("u", []byte(`{"version": 4, "claims": {}, "infoshared": {}}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := decodeID("u", []byte(`{"version": 4, "claims": {}, "infoshared": {}, "owner": "x"}`))
+	if err == nil || !strings.HasPrefix(err.Error(), "Corrupted ID record") {
+		t.Errorf("an ID with an unknown field was decoded: %v", err)
+	}
+}
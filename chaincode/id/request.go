@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+ * Attestation requests are kept one row per request, holding the claim url, so concurrent
+ * requests to the same attester write different keys and never conflict. Requests made before
+ * the rows were kept stay in the requestAttest_<id> document of the attester until they are
+ * attested or rejected.
+ */
+
+// ATTEST_REQUEST is the composite key prefix of the attestation request rows
+const ATTEST_REQUEST = "attestRequest~attester~user~claim"
+
+// putAttestRequest adds or replaces the request of the claim of the user to the attester
+func putAttestRequest(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string, url string) error {
+	key, err := APIstub.CreateCompositeKey(ATTEST_REQUEST, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte(url))
+}
+
+// attestRequested reports whether the attester was asked to attest the claim of the user
+func attestRequested(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) (bool, error) {
+	key, err := APIstub.CreateCompositeKey(ATTEST_REQUEST, []string{attester, user, claim})
+	if err != nil {
+		return false, err
+	}
+	url, err := APIstub.GetState(key)
+	if err != nil || url != nil {
+		return url != nil, err
+	}
+	legacy, err := getAttestClaim(APIstub, REQUEST+attester)
+	if err != nil {
+		return false, err
+	}
+	_, exist := legacy.Claim[user][claim]
+	return exist, nil
+}
+
+/*
+ * removeAttestRequest deletes the request of the claim of the user, the requestAttest_ document
+ * is only written when it still holds the request
+ */
+func removeAttestRequest(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) error {
+	key, err := APIstub.CreateCompositeKey(ATTEST_REQUEST, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	if err := APIstub.DelState(key); err != nil {
+		return err
+	}
+	legacy, err := getAttestClaim(APIstub, REQUEST+attester)
+	if err != nil {
+		return err
+	}
+	if _, exist := legacy.Claim[user][claim]; !exist {
+		return nil
+	}
+	delete(legacy.Claim[user], claim)
+	if len(legacy.Claim[user]) == 0 {
+		delete(legacy.Claim, user)
+	}
+	return putAttestClaim(APIstub, REQUEST+attester, legacy)
+}
+
+// attestRequests gathers the pending requests of the attester, rows and requestAttest_ document
+func attestRequests(APIstub shim.ChaincodeStubInterface, attester string) (AttestClaim, error) {
+	requests, err := getAttestClaim(APIstub, REQUEST+attester)
+	if err != nil {
+		return requests, err
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(ATTEST_REQUEST, []string{attester})
+	if err != nil {
+		return requests, err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return requests, err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return requests, err
+		}
+		user, claim := keyParts[1], keyParts[2]
+		if _, exist := requests.Claim[user]; !exist {
+			requests.Claim[user] = make(map[string]string)
+		}
+		requests.Claim[user][claim] = string(queryResponse.Value)
+	}
+	return requests, nil
+}
+
+/*
+ * mergeAttestRequests moves the request rows of merged to survivor, like mergeAttestDocuments
+ * does with the requestAttest_ documents: a request the survivor has too, or for a claim not in
+ * moved, is dropped and its deposit refunded.
+ */
+func mergeAttestRequests(APIstub shim.ChaincodeStubInterface, survivor string, merged string, moved map[string]bool) error {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(ATTEST_REQUEST, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	rows := []string{ATTEST_REQUEST, REQUEST_TIME, DEPOSIT_LOCK}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		attester, user, claim := keyParts[0], keyParts[1], keyParts[2]
+		if user != merged {
+			continue
+		}
+		requested, err := attestRequested(APIstub, attester, survivor, claim)
+		if err != nil {
+			return err
+		}
+		if requested || !moved[claim] {
+			if err := dropRows(APIstub, REQUEST, attester, merged, claim, rows); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, row := range rows {
+			if err := moveRow(APIstub, row, []string{attester, merged, claim}, []string{attester, survivor, claim}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
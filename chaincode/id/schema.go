@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// SCHEMA is the composite key object type of the claim schema registry
+const SCHEMA = "claimSchema~name"
+
+// Sensitivity levels of a claim type
+const (
+	SENSITIVITY_LOW    = "low"
+	SENSITIVITY_MEDIUM = "medium"
+	SENSITIVITY_HIGH   = "high"
+)
+
+// ClaimSchema describes a claim type that users can add to their ID and
+// attesters can attest. A value must match Pattern and/or JSONSchema.
+// ValidDays is how long a share of the claim lasts when the user does not say, zero for no default.
+type ClaimSchema struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern,omitempty"`
+	JSONSchema  string   `json:"jsonSchema,omitempty"`
+	Sensitivity string   `json:"sensitivity"`
+	Attesters   []string `json:"attesters"`
+	ValidDays   int      `json:"validDays"`
+}
+
+// claim types every ID is created with, registered on Init when missing
+var defaultClaimSchemas = []ClaimSchema{
+	{Name: "fullname", Pattern: `.+`, Sensitivity: SENSITIVITY_MEDIUM, Attesters: []string{}},
+	{Name: "docid", Pattern: `[A-Za-z0-9-]+`, Sensitivity: SENSITIVITY_HIGH, Attesters: []string{}},
+}
+
+/*
+ * REGISTER CLAIM SCHEMA (governance admins only)
+ * args: 0 => (ClaimName), 1 => (regex pattern), 2 => (JSON schema), 3 => (sensitivity low|medium|high),
+ *       4 => (allowed attesters, comma separated, empty for any), 5 => (default validDays of shares, 0 for none)
+ */
+func (s *SmartContract) registerClaimSchema(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("registerClaimSchema", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	validDays, err := strconv.Atoi(args[5])
+	if err != nil || validDays < 0 {
+		return shim.Error("validDays must be a positive number")
+	}
+	schema := ClaimSchema{
+		Name:        args[0],
+		Pattern:     args[1],
+		JSONSchema:  args[2],
+		Sensitivity: args[3],
+		Attesters:   splitList(args[4]),
+		ValidDays:   validDays,
+	}
+	if err := schema.check(); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := putClaimSchema(APIstub, schema); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * QUERY CLAIM SCHEMA
+ * args: 0 => (ClaimName)
+ */
+func (s *SmartContract) queryClaimSchema(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryClaimSchema", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	schema, err := getClaimSchema(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	schemaAsBytes, _ := json.Marshal(schema)
+	return shim.Success(schemaAsBytes)
+}
+
+/*
+ * QUERY ALL CLAIM SCHEMAS
+ * args: none
+ */
+func (s *SmartContract) queryClaimSchemas(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryClaimSchemas", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(SCHEMA, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	// buffer is a JSON array containing the registered schemas
+	var buffer bytes.Buffer
+	buffer.WriteString("[")
+	first := true
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !first {
+			buffer.WriteString(", ")
+		}
+		buffer.Write(queryResponse.Value)
+		first = false
+	}
+	buffer.WriteString("]")
+
+	return shim.Success(buffer.Bytes())
+}
+
+// seedClaimSchemas registers the default claim types that are not registered yet
+func seedClaimSchemas(APIstub shim.ChaincodeStubInterface) error {
+	for _, schema := range defaultClaimSchemas {
+		key, err := APIstub.CreateCompositeKey(SCHEMA, []string{schema.Name})
+		if err != nil {
+			return err
+		}
+		schemaAsBytes, err := APIstub.GetState(key)
+		if err != nil {
+			return err
+		}
+		if schemaAsBytes != nil {
+			continue
+		}
+		if err := putClaimSchema(APIstub, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putClaimSchema(APIstub shim.ChaincodeStubInterface, schema ClaimSchema) error {
+	key, err := APIstub.CreateCompositeKey(SCHEMA, []string{schema.Name})
+	if err != nil {
+		return err
+	}
+	schemaAsBytes, _ := json.Marshal(schema)
+	return APIstub.PutState(key, schemaAsBytes)
+}
+
+func getClaimSchema(APIstub shim.ChaincodeStubInterface, name string) (*ClaimSchema, error) {
+	key, err := APIstub.CreateCompositeKey(SCHEMA, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	schemaAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if schemaAsBytes == nil {
+		return nil, fmt.Errorf("Claim %s is not registered!", name)
+	}
+	schema := ClaimSchema{}
+	if err := json.Unmarshal(schemaAsBytes, &schema); err != nil {
+		return nil, fmt.Errorf("Claim schema %s is corrupted: %s", name, err.Error())
+	}
+	return &schema, nil
+}
+
+/*
+ * shareValidDays parses the validDays of a share, when it is empty the shortest default of the
+ * schemas of the shared claims applies
+ */
+func shareValidDays(APIstub shim.ChaincodeStubInterface, arg string, claims []string) (int, error) {
+	if arg != "" {
+		validDays, err := strconv.Atoi(arg)
+		if err != nil || validDays <= 0 {
+			return 0, fmt.Errorf("validDays must be a positive number")
+		}
+		return validDays, nil
+	}
+	validDays := 0
+	for _, claim := range claims {
+		schema, err := getClaimSchema(APIstub, claim)
+		if err != nil {
+			return 0, err
+		}
+		if schema.ValidDays > 0 && (validDays == 0 || schema.ValidDays < validDays) {
+			validDays = schema.ValidDays
+		}
+	}
+	if validDays == 0 {
+		return 0, fmt.Errorf("validDays must be given, the schema of %s has no default", strings.Join(claims, ", "))
+	}
+	return validDays, nil
+}
+
+// validateClaim checks that the claim is registered and its value of type typ conforms to the schema
+func validateClaim(APIstub shim.ChaincodeStubInterface, name string, typ string, value string) error {
+	schema, err := getClaimSchema(APIstub, name)
+	if err != nil {
+		return err
+	}
+	return schema.validate(typ, value)
+}
+
+// validateAttestationRequest checks that the claim, or the claim of an element, is registered and the attester may attest it
+func validateAttestationRequest(APIstub shim.ChaincodeStubInterface, name string, attester string) error {
+	name, _ = splitElement(name)
+	schema, err := getClaimSchema(APIstub, name)
+	if err != nil {
+		return err
+	}
+	if len(schema.Attesters) == 0 {
+		return nil
+	}
+	for _, allowed := range schema.Attesters {
+		if allowed == attester {
+			return nil
+		}
+	}
+	return fmt.Errorf("Attester %s is not allowed to attest %s", attester, name)
+}
+
+// check validates the schema definition itself
+func (schema ClaimSchema) check() error {
+	if schema.Name == "" {
+		return fmt.Errorf("Claim name must not be empty")
+	}
+	if strings.Contains(schema.Name, ELEMENT_SEP) {
+		return fmt.Errorf("Claim name must not contain %s", ELEMENT_SEP)
+	}
+	if schema.Pattern == "" && schema.JSONSchema == "" {
+		return fmt.Errorf("Claim %s needs a pattern or a JSON schema", schema.Name)
+	}
+	switch schema.Sensitivity {
+	case SENSITIVITY_LOW, SENSITIVITY_MEDIUM, SENSITIVITY_HIGH:
+	default:
+		return fmt.Errorf("Sensitivity must be one of %s, %s, %s", SENSITIVITY_LOW, SENSITIVITY_MEDIUM, SENSITIVITY_HIGH)
+	}
+	if schema.Pattern != "" {
+		if _, err := compilePattern(schema.Pattern); err != nil {
+			return fmt.Errorf("Invalid pattern for %s: %s", schema.Name, err.Error())
+		}
+	}
+	if schema.JSONSchema != "" {
+		var rules map[string]interface{}
+		if err := json.Unmarshal([]byte(schema.JSONSchema), &rules); err != nil {
+			return fmt.Errorf("Invalid JSON schema for %s: %s", schema.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// validate checks a claim value of type typ, in its canonical form, against the schema
+func (schema ClaimSchema) validate(typ string, value string) error {
+	if schema.Pattern != "" {
+		re, err := compilePattern(schema.Pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("Value of %s does not match %s", schema.Name, schema.Pattern)
+		}
+	}
+	if schema.JSONSchema != "" {
+		var rules map[string]interface{}
+		if err := json.Unmarshal([]byte(schema.JSONSchema), &rules); err != nil {
+			return err
+		}
+		doc, err := claimDocument(typ, value)
+		if err != nil {
+			return err
+		}
+		if err := validateJSON(rules, doc, schema.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * claimDocument is the JSON document a claim value of type typ is validated as: string and date
+ * claims are strings whatever they look like, only the other types are parsed
+ */
+func claimDocument(typ string, value string) (interface{}, error) {
+	switch typ {
+	case "", CLAIM_STRING, CLAIM_DATE:
+		return value, nil
+	case CLAIM_NUMBER:
+		return strconv.ParseFloat(value, 64)
+	case CLAIM_BOOLEAN:
+		return strconv.ParseBool(value)
+	}
+	var doc interface{}
+	err := json.Unmarshal([]byte(value), &doc)
+	return doc, err
+}
+
+// patterns always have to match the whole value
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+/*
+ * validateJSON supports the subset of JSON schema needed for claims:
+ * type, enum, minLength, maxLength, pattern, minimum, maximum, required, properties and items
+ */
+func validateJSON(rules map[string]interface{}, doc interface{}, path string) error {
+	if t, ok := rules["type"].(string); ok {
+		if !jsonTypeOf(doc, t) {
+			return fmt.Errorf("%s must be of type %s", path, t)
+		}
+	}
+	if enum, ok := rules["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			a, _ := json.Marshal(e)
+			b, _ := json.Marshal(doc)
+			if bytes.Equal(a, b) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s is not one of the allowed values", path)
+		}
+	}
+
+	switch v := doc.(type) {
+	case string:
+		if min, ok := rules["minLength"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s is shorter than %v", path, min)
+		}
+		if max, ok := rules["maxLength"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s is longer than %v", path, max)
+		}
+		if pattern, ok := rules["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return err
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s does not match %s", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := rules["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%s is lower than %v", path, min)
+		}
+		if max, ok := rules["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%s is greater than %v", path, max)
+		}
+	case map[string]interface{}:
+		if required, ok := rules["required"].([]interface{}); ok {
+			for _, r := range required {
+				name, _ := r.(string)
+				if _, exist := v[name]; !exist {
+					return fmt.Errorf("%s.%s is required", path, name)
+				}
+			}
+		}
+		if properties, ok := rules["properties"].(map[string]interface{}); ok {
+			for name, sub := range properties {
+				subRules, ok := sub.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if field, exist := v[name]; exist {
+					if err := validateJSON(subRules, field, path+"."+name); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := rules["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateJSON(items, item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeOf(doc interface{}, t string) bool {
+	switch v := doc.(type) {
+	case string:
+		return t == "string"
+	case float64:
+		return t == "number" || (t == "integer" && v == float64(int64(v)))
+	case bool:
+		return t == "boolean"
+	case map[string]interface{}:
+		return t == "object"
+	case []interface{}:
+		return t == "array"
+	case nil:
+		return t == "null"
+	}
+	return false
+}
+
+// splitList parses a comma separated argument, ignoring empty entries
+func splitList(arg string) []string {
+	list := []string{}
+	for _, item := range strings.Split(arg, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// optionalArg returns args[i], or an empty string when the optional argument was not given
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
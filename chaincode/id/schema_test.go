@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringClaimsAreNotParsed(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "phone", "", `{"type": "string", "maxLength": 10}`, SENSITIVITY_LOW, "", "0")
+	stub.mustInvoke("registerClaimSchema", "age", "", `{"type": "integer", "minimum": 18}`, SENSITIVITY_LOW, "", "0")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+
+	for _, value := range []string{"5551234", "true", "null", "[1]"} {
+		stub.with(TRANSIENT_VALUE, value)
+		stub.mustInvoke("addClaim", "alice", "phone")
+	}
+	stub.with(TRANSIENT_VALUE, "55512345678")
+	if message := stub.mustFail("addClaim", "alice", "phone"); message != "phone is longer than 10" {
+		t.Errorf("unexpected error %s", message)
+	}
+
+	stub.with(TRANSIENT_VALUE, "30")
+	if message := stub.mustFail("addClaim", "alice", "age"); message != "age must be of type integer" {
+		t.Errorf("a string was accepted as an integer: %s", message)
+	}
+	stub.with(TRANSIENT_VALUE, "17")
+	if message := stub.mustFail("addClaim", "alice", "age", CLAIM_NUMBER); message != "age is lower than 18" {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.with(TRANSIENT_VALUE, "30")
+	stub.mustInvoke("addClaim", "alice", "age", CLAIM_NUMBER)
+}
+
+func TestSchemaPattern(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.with(TRANSIENT_VALUE, "x")
+	if message := stub.mustFail("addClaim", "alice", "emial"); message != "Claim emial is not registered!" {
+		t.Errorf("an unregistered claim was accepted: %s", message)
+	}
+	stub.with(TRANSIENT_VALUE, "P 1")
+	if message := stub.mustFail("addClaim", "alice", "docid"); !strings.HasPrefix(message, "Value of docid does not match") {
+		t.Errorf("unexpected error %s", message)
+	}
+}
+
+func TestShareValidDaysDefault(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "rp", TEST_ORG, TEST_CONTROLLER)
+	stub.mustInvoke("registerClaimSchema", "email", ".+@.+", "", SENSITIVITY_MEDIUM, "", "30")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+	stub.with(TRANSIENT_VALUE, "alice@example.com")
+	stub.mustInvoke("addClaim", "alice", "email")
+
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+	if days := stub.getID("alice").Infoshared["rp"]["email"].ValidDay; days != 30 {
+		t.Errorf("the share is valid %d days, want the 30 of the schema", days)
+	}
+	stub.with(TRANSIENT_TOKEN, "t2")
+	if message := stub.mustFail("shareinfo", "alice", "rp", "fullname"); !strings.Contains(message, "has no default") {
+		t.Errorf("a share without validity was granted: %s", message)
+	}
+	stub.with(TRANSIENT_TOKEN, "t3")
+	if message := stub.mustFail("shareinfo", "alice", "rp", "email", "-1"); message != "validDays must be a positive number" {
+		t.Errorf("unexpected error %s", message)
+	}
+}
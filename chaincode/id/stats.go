@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Attester statistics, so users can pick attesters that actually respond. Every event adds a delta
+ * row keyed by its transaction id, as in the high-throughput sample, instead of updating a counter:
+ * concurrent requests to the same attester then never conflict. Queries aggregate the rows, and
+ * pruneAttesterStats folds the counters of an attester back into one row and its turnaround
+ * samples into one row per turnaround, the value of the row counting the samples folded into it.
+ */
+
+// Composite key prefixes of the statistics
+const (
+	STAT         = "attesterStat~attester~metric~value~txId"
+	TURNAROUND   = "attesterTurnaround~attester~seconds~txId"
+	REQUEST_TIME = "attestRequestTime~attester~user~claim"
+)
+
+// Counted events of an attester
+const (
+	METRIC_REQUESTS = "requests"
+	METRIC_ATTESTED = "attested"
+	METRIC_REJECTED = "rejected"
+	METRIC_REVOKED  = "revoked"
+)
+
+// METRIC_TURNAROUND ranks attesters by their median turnaround in leaderboards
+const METRIC_TURNAROUND = "medianTurnaround"
+
+// AttesterStats are the aggregated statistics of an attester, turnarounds are in seconds
+type AttesterStats struct {
+	Attester         string `json:"attester"`
+	Requests         int64  `json:"requests"`
+	Attested         int64  `json:"attested"`
+	Rejected         int64  `json:"rejected"`
+	Revoked          int64  `json:"revoked"`
+	Pending          int64  `json:"pending"`
+	MedianTurnaround int64  `json:"medianTurnaround"`
+	Turnarounds      int64  `json:"turnarounds"`
+
+	samples []turnaroundSample
+}
+
+// turnaroundSample is a turnaround taken count times
+type turnaroundSample struct {
+	seconds int64
+	count   int64
+}
+
+// countEvent adds a delta row of one event of metric for the attester
+func countEvent(APIstub shim.ChaincodeStubInterface, attester string, metric string) error {
+	return addStatRow(APIstub, attester, metric, 1)
+}
+
+func addStatRow(APIstub shim.ChaincodeStubInterface, attester string, metric string, value int64) error {
+	key, err := APIstub.CreateCompositeKey(STAT, []string{attester, metric, strconv.FormatInt(value, 10), APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte{0x00})
+}
+
+// startTurnaround records when the attester was asked to attest the claim of the user
+func startTurnaround(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) error {
+	requested, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	key, err := APIstub.CreateCompositeKey(REQUEST_TIME, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte(strconv.FormatInt(requested, 10)))
+}
+
+/*
+ * endTurnaround closes the request of the claim of the user, a turnaround sample is added when
+ * the request was attested
+ */
+func endTurnaround(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string, attested bool) error {
+	key, err := APIstub.CreateCompositeKey(REQUEST_TIME, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	requestedAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return err
+	}
+	// requests made before the statistics were kept have no start time
+	if requestedAsBytes == nil {
+		return nil
+	}
+	if err := APIstub.DelState(key); err != nil {
+		return err
+	}
+	if !attested {
+		return nil
+	}
+	requested, err := strconv.ParseInt(string(requestedAsBytes), 10, 64)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	turnaround := now - requested
+	if turnaround < 0 {
+		turnaround = 0
+	}
+	return addTurnaroundRow(APIstub, attester, turnaround, 1)
+}
+
+func addTurnaroundRow(APIstub shim.ChaincodeStubInterface, attester string, seconds int64, count int64) error {
+	key, err := APIstub.CreateCompositeKey(TURNAROUND, []string{attester, strconv.FormatInt(seconds, 10), APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, []byte(strconv.FormatInt(count, 10)))
+}
+
+// sampleCount is the number of samples a turnaround row holds, rows of single samples used to hold 0x00
+func sampleCount(value []byte) (int64, error) {
+	if len(value) == 1 && value[0] == 0x00 {
+		return 1, nil
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+/*
+ * QUERY ATTESTER STATS
+ * args: 0 => (idAttester)
+ */
+func (s *SmartContract) queryAttesterStats(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryAttesterStats", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	stats, err := aggregateStats(APIstub, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	result := AttesterStats{Attester: args[0]}
+	if attester, ok := stats[args[0]]; ok {
+		result = *attester
+	}
+	statsAsBytes, _ := json.Marshal(result)
+	return shim.Success(statsAsBytes)
+}
+
+/*
+ * ATTESTER LEADERBOARD, the attesters ranked by a metric: most requests, attested, fewest
+ * rejected or revoked, or fastest medianTurnaround (only attesters that attested something)
+ * args: 0 => (metric), 1 => (limit, 0 for all)
+ */
+func (s *SmartContract) attesterLeaderboard(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("attesterLeaderboard", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	metric := args[0]
+	limit, err := strconv.Atoi(args[1])
+	if err != nil || limit < 0 {
+		return shim.Error("limit must be a positive number")
+	}
+	var value func(stats *AttesterStats) int64
+	ascending := false
+	switch metric {
+	case METRIC_REQUESTS:
+		value = func(stats *AttesterStats) int64 { return stats.Requests }
+	case METRIC_ATTESTED:
+		value = func(stats *AttesterStats) int64 { return stats.Attested }
+	case METRIC_REJECTED:
+		value, ascending = func(stats *AttesterStats) int64 { return stats.Rejected }, true
+	case METRIC_REVOKED:
+		value, ascending = func(stats *AttesterStats) int64 { return stats.Revoked }, true
+	case METRIC_TURNAROUND:
+		value, ascending = func(stats *AttesterStats) int64 { return stats.MedianTurnaround }, true
+	default:
+		return shim.Error(fmt.Sprintf("Unknown metric %s", metric))
+	}
+
+	stats, err := aggregateStats(APIstub, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	board := []*AttesterStats{}
+	for _, attester := range stats {
+		if metric == METRIC_TURNAROUND && attester.Turnarounds == 0 {
+			continue
+		}
+		board = append(board, attester)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		a, b := value(board[i]), value(board[j])
+		if a != b {
+			return (a < b) == ascending
+		}
+		return board[i].Attester < board[j].Attester
+	})
+	if limit > 0 && len(board) > limit {
+		board = board[:limit]
+	}
+	boardAsBytes, _ := json.Marshal(board)
+	return shim.Success(boardAsBytes)
+}
+
+/*
+ * PRUNE ATTESTER STATS (governance admins only), replaces the counter rows of an attester with one
+ * row per metric and its turnaround samples with one row per turnaround. Run it when the network
+ * is quiet, like the prune functions of high-throughput.
+ * args: 0 => (idAttester)
+ */
+func (s *SmartContract) pruneAttesterStats(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("pruneAttesterStats", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(STAT, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	totals := map[string]int64{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		value, err := strconv.ParseInt(keyParts[2], 10, 64)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		totals[keyParts[1]] += value
+		if err := APIstub.DelState(queryResponse.Key); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	metrics := make([]string, 0, len(totals))
+	for metric := range totals {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	for _, metric := range metrics {
+		if err := addStatRow(APIstub, args[0], metric, totals[metric]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := pruneTurnarounds(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// pruneTurnarounds folds the turnaround samples of the attester into one row per turnaround
+func pruneTurnarounds(APIstub shim.ChaincodeStubInterface, attester string) error {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(TURNAROUND, []string{attester})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	counts := map[int64]int64{}
+	turnarounds := []int64{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.ParseInt(keyParts[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		count, err := sampleCount(queryResponse.Value)
+		if err != nil {
+			return err
+		}
+		if _, ok := counts[seconds]; !ok {
+			turnarounds = append(turnarounds, seconds)
+		}
+		counts[seconds] += count
+		if err := APIstub.DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+	for _, seconds := range turnarounds {
+		if err := addTurnaroundRow(APIstub, attester, seconds, counts[seconds]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * aggregateStats sums the delta rows of the attesters, all attesters when attesters is empty
+ */
+func aggregateStats(APIstub shim.ChaincodeStubInterface, attesters []string) (map[string]*AttesterStats, error) {
+	stats := map[string]*AttesterStats{}
+	get := func(attester string) *AttesterStats {
+		if _, ok := stats[attester]; !ok {
+			stats[attester] = &AttesterStats{Attester: attester}
+		}
+		return stats[attester]
+	}
+
+	counters, err := APIstub.GetStateByPartialCompositeKey(STAT, attesters)
+	if err != nil {
+		return nil, err
+	}
+	defer counters.Close()
+	for counters.HasNext() {
+		queryResponse, err := counters.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := strconv.ParseInt(keyParts[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		attester := get(keyParts[0])
+		switch keyParts[1] {
+		case METRIC_REQUESTS:
+			attester.Requests += value
+		case METRIC_ATTESTED:
+			attester.Attested += value
+		case METRIC_REJECTED:
+			attester.Rejected += value
+		case METRIC_REVOKED:
+			attester.Revoked += value
+		}
+	}
+
+	samples, err := APIstub.GetStateByPartialCompositeKey(TURNAROUND, attesters)
+	if err != nil {
+		return nil, err
+	}
+	defer samples.Close()
+	for samples.HasNext() {
+		queryResponse, err := samples.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := strconv.ParseInt(keyParts[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		count, err := sampleCount(queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		attester := get(keyParts[0])
+		attester.samples = append(attester.samples, turnaroundSample{seconds: seconds, count: count})
+		attester.Turnarounds += count
+	}
+
+	for _, attester := range stats {
+		attester.Pending = attester.Requests - attester.Attested - attester.Rejected
+		if attester.Pending < 0 {
+			attester.Pending = 0
+		}
+		attester.MedianTurnaround = median(attester.samples, attester.Turnarounds)
+	}
+	return stats, nil
+}
+
+// median of the total samples, the mean of the two middle ones when total is even
+func median(samples []turnaroundSample, total int64) int64 {
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].seconds < samples[j].seconds })
+	// the value at position n of the sorted samples
+	at := func(n int64) int64 {
+		for _, sample := range samples {
+			if n < sample.count {
+				return sample.seconds
+			}
+			n -= sample.count
+		}
+		return samples[len(samples)-1].seconds
+	}
+	return (at((total-1)/2) + at(total/2)) / 2
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func queryStats(t *testing.T, stub *testStub, attester string) AttesterStats {
+	t.Helper()
+	stats := AttesterStats{}
+	if err := json.Unmarshal(stub.mustInvoke("queryAttesterStats", attester), &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+// countRows counts the rows under the composite key prefix objectType
+func countRows(stub *testStub, objectType string) int {
+	rows := 0
+	for key := range stub.State {
+		if strings.HasPrefix(key, "\x00"+objectType+"\x00") {
+			rows++
+		}
+	}
+	return rows
+}
+
+func TestRequestsAreRows(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url1")
+	stub.mustInvoke("requestAttestation", "acme", "alice", "docid", "url2")
+	if stub.State[REQUEST+"acme"] != nil || countRows(stub, ATTEST_REQUEST) != 2 {
+		t.Errorf("the requests were not written to rows of their own")
+	}
+	requests := []struct {
+		User   string            `json:"user"`
+		Claims map[string]string `json:"claims"`
+	}{}
+	if err := json.Unmarshal(stub.mustInvoke("queryRequestAttestation", "acme"), &requests); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].Claims["fullname"] != "url1" || requests[0].Claims["docid"] != "url2" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+
+	stub.mustInvoke("createAttestation", "acme", "alice", "fullname", "hash")
+	stub.mustInvoke("rejectAttestation", "acme", "alice", "docid")
+	if countRows(stub, ATTEST_REQUEST) != 0 {
+		t.Errorf("an answered request was kept")
+	}
+	if message := stub.mustFail("rejectAttestation", "acme", "alice", "docid"); message != "Request of Attestation not Found!" {
+		t.Errorf("unexpected error %s", message)
+	}
+}
+
+func TestRequestsOfTheDocument(t *testing.T) {
+	stub := newAttesterStub(t)
+	// a request made before the rows were kept
+	stub.start()
+	if err := putAttestClaim(stub, REQUEST+"acme", AttestClaim{Claim: map[string]map[string]string{"alice": {"fullname": "url"}}}); err != nil {
+		t.Fatal(err)
+	}
+	stub.end()
+
+	stub.mustInvoke("createAttestation", "acme", "alice", "fullname", "hash")
+	document := AttestClaim{}
+	if err := json.Unmarshal(stub.State[REQUEST+"acme"], &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Claim) != 0 {
+		t.Errorf("the attested request was kept in the document: %+v", document)
+	}
+}
+
+func TestAttesterStats(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.createID("bob", "P2")
+	for _, claim := range []string{"fullname", "docid"} {
+		stub.mustInvoke("requestAttestation", "acme", "alice", claim, "url")
+	}
+	stub.mustInvoke("requestAttestation", "acme", "bob", "fullname", "url")
+	stub.mustInvoke("createAttestation", "acme", "alice", "fullname", "hash")
+	stub.mustInvoke("createAttestation", "acme", "bob", "fullname", "hash")
+	stub.mustInvoke("rejectAttestation", "acme", "alice", "docid")
+	stub.mustInvoke("revokeAttestation", "acme", "bob", "fullname")
+
+	stats := queryStats(t, stub, "acme")
+	if stats.Requests != 3 || stats.Attested != 2 || stats.Rejected != 1 || stats.Revoked != 1 || stats.Pending != 0 || stats.Turnarounds != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	board := []AttesterStats{}
+	if err := json.Unmarshal(stub.mustInvoke("attesterLeaderboard", METRIC_ATTESTED, "0"), &board); err != nil {
+		t.Fatal(err)
+	}
+	if len(board) != 1 || board[0].Attester != "acme" {
+		t.Errorf("unexpected leaderboard %+v", board)
+	}
+	stub.mustFail("attesterLeaderboard", "fastest", "0")
+}
+
+func TestPruneFoldsTurnarounds(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.createID("bob", "P2")
+	for _, user := range []string{"alice", "bob"} {
+		stub.mustInvoke("requestAttestation", "acme", user, "fullname", "url")
+		stub.mustInvoke("createAttestation", "acme", user, "fullname", "hash")
+	}
+	// a sample written before the rows counted their samples
+	stub.start()
+	key, _ := stub.CreateCompositeKey(TURNAROUND, []string{"acme", "0", "old"})
+	stub.PutState(key, []byte{0x00})
+	stub.end()
+
+	before := queryStats(t, stub, "acme")
+	if before.Turnarounds != 3 {
+		t.Fatalf("unexpected stats %+v", before)
+	}
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("pruneAttesterStats", "acme")
+	// the turnarounds are seconds apart at most, equal ones share a row
+	if countRows(stub, TURNAROUND) >= 3 || countRows(stub, STAT) != 2 {
+		t.Errorf("the samples were not folded: %d turnaround rows", countRows(stub, TURNAROUND))
+	}
+	if after := queryStats(t, stub, "acme"); !reflect.DeepEqual(after, before) {
+		t.Errorf("pruning changed the stats from %+v to %+v", before, after)
+	}
+}
+
+func TestMedianOfFoldedSamples(t *testing.T) {
+	cases := []struct {
+		samples []turnaroundSample
+		want    int64
+	}{
+		{nil, 0},
+		{[]turnaroundSample{{seconds: 20, count: 1}, {seconds: 10, count: 3}}, 10},
+		{[]turnaroundSample{{seconds: 10, count: 2}, {seconds: 20, count: 2}}, 15},
+		{[]turnaroundSample{{seconds: 30, count: 1}, {seconds: 10, count: 1}, {seconds: 20, count: 1}}, 20},
+	}
+	for _, c := range cases {
+		total := int64(0)
+		for _, sample := range c.samples {
+			total += sample.count
+		}
+		if got := median(c.samples, total); got != c.want {
+			t.Errorf("median of %+v is %d, want %d", c.samples, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Share tokens are generated off-chain by the user's client and handed to the relying party.
+ * The ledger only keeps a salted hash of the token, so reading an ID record does not reveal
+ * a token that could be replayed.
+ */
+
+// tokenSalt derives the salt of a share token from values unique to the credential
+func tokenSalt(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h[:16])
+}
+
+func hashToken(salt string, token string) string {
+	h := sha256.Sum256([]byte(salt + ":" + token))
+	return hex.EncodeToString(h[:])
+}
+
+// matches reports whether token is the one the credential was granted with
+func (c Credential) matches(token string) bool {
+	return hmac.Equal([]byte(c.TokenHash), []byte(hashToken(c.Salt, token)))
+}
+
+// usable reports whether the credential can still be presented at now
+func (c Credential) usable(now int64) error {
+	if c.expired(now) {
+		return fmt.Errorf("Share token has expired")
+	}
+	if c.SingleUse && c.Redeemed != 0 {
+		return fmt.Errorf("Share token was already used")
+	}
+	return nil
+}
+
+/*
+ * REDEEM SHARE TOKEN, validates the token a relying party presents for a shared claim without
+ * using it up: single use tokens are used up when the relying party reads the claim with
+ * accessSharedClaim. Only clients of the org the relying party is registered with can redeem its tokens.
+ * args: 0 => (idClient or pairwise pseudonym), 1 => (relyingParty), 2 => (ClaimName), 3 => (token, transient map only)
+ * The token is only accepted in the transient map ("token"), it is spliced in as args[3].
+ */
+func (s *SmartContract) redeemShareToken(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	args, err := transientArgs(APIstub, args, 3, TRANSIENT_TOKEN)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkArgs("redeemShareToken", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, _, err := callerParty(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	user, err := resolveUser(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, user)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	credential, ok := id.Infoshared[args[1]][args[2]]
+	if !ok || !credential.matches(args[3]) || (credential.Pseudonymous && args[0] == user) {
+		return shim.Error("Invalid share token")
+	}
+	if err := credential.usable(now); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the access is billed when the relying party reads the claim with accessSharedClaim
+
+	result := map[string]interface{}{"claim": args[2], "relyingParty": args[1], "singleUse": credential.SingleUse}
+	if credential.Granted != 0 {
+		result["expires"] = credential.Granted + int64(credential.ValidDay)*DAY
+	}
+	resultAsBytes, _ := json.Marshal(result)
+	return shim.Success(resultAsBytes)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSingleUseTokenSurvivesRedeem(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email", "", "", "", "true")
+
+	stub.with(TRANSIENT_TOKEN, "wrong")
+	if message := stub.mustFail("redeemShareToken", "alice", "rp", "email"); message != "Invalid share token" {
+		t.Errorf("unexpected error %s", message)
+	}
+	for i := 0; i < 2; i++ {
+		stub.with(TRANSIENT_TOKEN, "t1")
+		stub.mustInvoke("redeemShareToken", "alice", "rp", "email")
+	}
+	if credential := stub.getID("alice").Infoshared["rp"]["email"]; credential.Redeemed != 0 {
+		t.Errorf("redeeming used up the token: %+v", credential)
+	}
+
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("accessSharedClaim", "alice", "rp", "email")
+	stub.with(TRANSIENT_TOKEN, "t1")
+	if message := stub.mustFail("accessSharedClaim", "alice", "rp", "email"); message != "Access to email: Share token was already used" {
+		t.Errorf("a single use token was read twice: %s", message)
+	}
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustFail("redeemShareToken", "alice", "rp", "email")
+}
+
+func TestPseudonymousTokenNeedsPseudonym(t *testing.T) {
+	stub := newSharingStub(t)
+	stub.with(TRANSIENT_TOKEN, "t1", TRANSIENT_SECRET, "alice")
+	stub.mustInvoke("shareinfo", "alice", "rp", "email")
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustFail("redeemShareToken", "alice", "rp", "email")
+	stub.with(TRANSIENT_TOKEN, "t1")
+	stub.mustInvoke("redeemShareToken", pairwisePseudonym([]byte("alice"), "rp"), "rp", "email")
+}
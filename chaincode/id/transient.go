@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+/*
+ * Sensitive arguments can be sent in the transient map of the proposal instead of the
+ * positional args, so they are not recorded in the transaction stored in every block.
+ * The positional argument is then left out.
+ */
+
+// Transient map keys of the sensitive arguments
+const (
+	TRANSIENT_FULLNAME = "fullname"
+	TRANSIENT_DOCID    = "docid"
+	TRANSIENT_TOKEN    = "token"
+)
+
+/*
+ * transientArgs inserts the values of the transient keys into args at pos when the transient map
+ * carries them, and returns args unchanged when it carries none of them
+ */
+func transientArgs(APIstub shim.ChaincodeStubInterface, args []string, pos int, keys ...string) ([]string, error) {
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, key := range keys {
+		if value, ok := transient[key]; ok {
+			values = append(values, string(value))
+		}
+	}
+	if len(values) == 0 {
+		return args, nil
+	}
+	if len(values) != len(keys) {
+		return nil, fmt.Errorf("The transient map must carry all of %v", keys)
+	}
+	if pos > len(args) {
+		return nil, fmt.Errorf("Incorrect number of arguments. Expecting at least %d", pos)
+	}
+
+	spliced := make([]string, 0, len(args)+len(values))
+	spliced = append(spliced, args[:pos]...)
+	spliced = append(spliced, values...)
+	return append(spliced, args[pos:]...), nil
+}
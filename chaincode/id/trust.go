@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Trust framework: governance registers trust roots, a root accredits attesters for claim types
+ * and an accredited attester can sub-accredit other attesters for the same claim types, as deep
+ * as its own accreditation allows. Every accreditation keeps its path from the root, and
+ * createAttestation stores the path of the attester next to the attestation, so a relying party
+ * can check with trustChain why an attester_<id> entry can be trusted.
+ */
+
+// Composite key prefixes of the trust framework
+const (
+	TRUST_ROOT       = "trustRoot~root"
+	ACCREDITATION    = "accreditation~attester~claim"
+	ATTESTATION_PATH = "attestationPath~attester~user~claim"
+)
+
+// TrustRoot is a root of the trust framework
+type TrustRoot struct {
+	Root       string `json:"root"`
+	Name       string `json:"name"`
+	Registered int64  `json:"registered"`
+}
+
+/*
+ * Accreditation allows Attester to attest Claim. Path runs from the root to the attester,
+ * MaxDepth is how many levels of sub-accreditation are allowed below the attester and Org the
+ * org the attester is registered with, whose clients can sub-accredit on behalf of the attester.
+ */
+type Accreditation struct {
+	Attester   string   `json:"attester"`
+	Claim      string   `json:"claim"`
+	Accreditor string   `json:"accreditor"`
+	Path       []string `json:"path"`
+	MaxDepth   int      `json:"maxDepth"`
+	Org        string   `json:"org"`
+	Granted    int64    `json:"granted"`
+	Expires    int64    `json:"expires,omitempty"`
+	TxID       string   `json:"txId"`
+}
+
+// valid reports whether the accreditation can be relied on at now
+func (a Accreditation) valid(now int64) bool {
+	return a.Expires == 0 || now < a.Expires
+}
+
+// AttestationPath is the accreditation path of an attester when it attested a claim
+type AttestationPath struct {
+	Attester string   `json:"attester"`
+	User     string   `json:"user"`
+	Claim    string   `json:"claim"`
+	Path     []string `json:"path"`
+	TxID     string   `json:"txId"`
+}
+
+// TrustVerdict is the answer of trustChain
+type TrustVerdict struct {
+	Attester string   `json:"attester"`
+	User     string   `json:"user"`
+	Claim    string   `json:"claim"`
+	Root     string   `json:"root"`
+	Trusted  bool     `json:"trusted"`
+	Path     []string `json:"path,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+/*
+ * REGISTER TRUST ROOT (governance admins only)
+ * args: 0 => (root id), 1 => (name)
+ */
+func (s *SmartContract) registerTrustRoot(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("registerTrustRoot", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	registered, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := APIstub.CreateCompositeKey(TRUST_ROOT, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	rootAsBytes, _ := json.Marshal(TrustRoot{Root: args[0], Name: args[1], Registered: registered})
+	if err := APIstub.PutState(key, rootAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * ACCREDIT ATTESTER, by a trust root (governance admins only) or by an attester accredited for
+ * the claims with a MaxDepth left (clients of the accreditor's org only). The attester must be
+ * registered with registerParty. An accreditation is never overwritten, to change it revoke it
+ * and accredit again.
+ * args: 0 => (accreditor, root or attester id), 1 => (attester id), 2 => (claims, comma separated),
+ *       3 => (maxDepth, levels of sub-accreditation allowed), 4 => (validDays, 0 for no expiry)
+ */
+func (s *SmartContract) accreditAttester(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("accreditAttester", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	accreditor, attester, claims := args[0], args[1], splitList(args[2])
+	if len(claims) == 0 {
+		return shim.Error("At least one claim is required")
+	}
+	maxDepth, err := strconv.Atoi(args[3])
+	if err != nil || maxDepth < 0 {
+		return shim.Error("maxDepth must be a positive number")
+	}
+	validDays, err := strconv.Atoi(args[4])
+	if err != nil || validDays < 0 {
+		return shim.Error("validDays must be a positive number")
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	party, err := getParty(APIstub, attester)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	root, err := getTrustRoot(APIstub, accreditor)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if root != nil {
+		if err := requireRole(APIstub, GOVERNANCE); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	for _, claim := range claims {
+		if _, err := getClaimSchema(APIstub, claim); err != nil {
+			return shim.Error(err.Error())
+		}
+		existing, err := getAccreditation(APIstub, attester, claim)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if existing != nil {
+			return shim.Error(fmt.Sprintf("%s is already accredited for %s, revoke the accreditation first", attester, claim))
+		}
+		accreditation := Accreditation{Attester: attester, Claim: claim, Accreditor: accreditor, MaxDepth: maxDepth, Org: party.Org, Granted: now, TxID: APIstub.GetTxID()}
+		if validDays > 0 {
+			accreditation.Expires = now + int64(validDays)*DAY
+		}
+		if root != nil {
+			accreditation.Path = []string{accreditor, attester}
+		} else {
+			parent, err := getAccreditation(APIstub, accreditor, claim)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if parent == nil || !parent.valid(now) {
+				return shim.Error(fmt.Sprintf("%s is not accredited for %s", accreditor, claim))
+			}
+			if parent.Org != org {
+				return shim.Error(fmt.Sprintf("Only %s can accredit on behalf of %s", parent.Org, accreditor))
+			}
+			if maxDepth >= parent.MaxDepth {
+				return shim.Error(fmt.Sprintf("%s can only accredit for %s with a maxDepth below %d", accreditor, claim, parent.MaxDepth))
+			}
+			for _, member := range parent.Path {
+				if member == attester {
+					return shim.Error(fmt.Sprintf("%s is already in the accreditation path of %s", attester, accreditor))
+				}
+			}
+			// a sub-accreditation never outlives its parent
+			if parent.Expires != 0 && (accreditation.Expires == 0 || accreditation.Expires > parent.Expires) {
+				accreditation.Expires = parent.Expires
+			}
+			accreditation.Path = append(append([]string{}, parent.Path...), attester)
+		}
+		if err := putAccreditation(APIstub, accreditation); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * REVOKE ACCREDITATION (governance admins only), the attestations made under it are no longer trusted
+ * args: 0 => (attester id), 1 => (ClaimName)
+ */
+func (s *SmartContract) revokeAccreditation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("revokeAccreditation", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := APIstub.CreateCompositeKey(ACCREDITATION, []string{args[0], args[1]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := APIstub.DelState(key); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * QUERY ACCREDITATIONS of an attester
+ * args: 0 => (attester id)
+ */
+func (s *SmartContract) queryAccreditations(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryAccreditations", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(ACCREDITATION, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	accreditations := []Accreditation{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		accreditation := Accreditation{}
+		if err := json.Unmarshal(queryResponse.Value, &accreditation); err != nil {
+			return shim.Error(err.Error())
+		}
+		accreditations = append(accreditations, accreditation)
+	}
+	accreditationsAsBytes, _ := json.Marshal(accreditations)
+	return shim.Success(accreditationsAsBytes)
+}
+
+/*
+ * TRUST CHAIN, whether the attestation of a claim of the user by the attester chains back to root
+ * through accreditations that are still valid
+ * args: 0 => (attester id), 1 => (idClient), 2 => (ClaimName), 3 => (root id)
+ */
+func (s *SmartContract) trustChain(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("trustChain", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	verdict, err := verifyTrustChain(APIstub, args[0], args[1], args[2], args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	verdictAsBytes, _ := json.Marshal(verdict)
+	return shim.Success(verdictAsBytes)
+}
+
+func verifyTrustChain(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string, rootID string) (TrustVerdict, error) {
+	verdict := TrustVerdict{Attester: attester, User: user, Claim: claim, Root: rootID}
+
+	attestations, err := getAttestClaim(APIstub, ATTEST+attester)
+	if err != nil {
+		return verdict, err
+	}
+	if _, exist := attestations.Claim[user][claim]; !exist {
+		verdict.Reason = "not attested"
+		return verdict, nil
+	}
+	path, err := getAttestationPath(APIstub, attester, user, claim)
+	if err != nil {
+		return verdict, err
+	}
+	if path == nil {
+		verdict.Reason = "attester was not accredited"
+		return verdict, nil
+	}
+	verdict.Path = path.Path
+	if path.Path[0] != rootID {
+		verdict.Reason = "accredited under another root"
+		return verdict, nil
+	}
+	root, err := getTrustRoot(APIstub, rootID)
+	if err != nil {
+		return verdict, err
+	}
+	if root == nil {
+		verdict.Reason = "unknown root"
+		return verdict, nil
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return verdict, err
+	}
+	// every link must still hold, an accreditation may have been revoked, replaced or expired since,
+	// elements are attested under the accreditation of their claim
+	name, _ := splitElement(claim)
+	for i := 1; i < len(path.Path); i++ {
+		accreditation, err := getAccreditation(APIstub, path.Path[i], name)
+		if err != nil {
+			return verdict, err
+		}
+		if accreditation == nil || accreditation.Accreditor != path.Path[i-1] || !accreditation.valid(now) {
+			verdict.Reason = fmt.Sprintf("accreditation of %s by %s no longer holds", path.Path[i], path.Path[i-1])
+			return verdict, nil
+		}
+	}
+	verdict.Trusted = true
+	return verdict, nil
+}
+
+/*
+ * recordAttestationPath stores the accreditation path the attester has for claim next to its
+ * attestation, nothing is stored when the attester is not accredited. An element <claim>#<id>
+ * takes the path of the accreditation for <claim>.
+ */
+func recordAttestationPath(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) error {
+	key, err := APIstub.CreateCompositeKey(ATTESTATION_PATH, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	name, _ := splitElement(claim)
+	accreditation, err := getAccreditation(APIstub, attester, name)
+	if err != nil {
+		return err
+	}
+	if accreditation == nil || !accreditation.valid(now) {
+		// a previous path does not apply to the new attestation
+		return clearAttestationPath(APIstub, attester, user, claim)
+	}
+	pathAsBytes, _ := json.Marshal(AttestationPath{Attester: attester, User: user, Claim: claim, Path: accreditation.Path, TxID: APIstub.GetTxID()})
+	return APIstub.PutState(key, pathAsBytes)
+}
+
+func clearAttestationPath(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) error {
+	key, err := APIstub.CreateCompositeKey(ATTESTATION_PATH, []string{attester, user, claim})
+	if err != nil {
+		return err
+	}
+	return APIstub.DelState(key)
+}
+
+func getAttestationPath(APIstub shim.ChaincodeStubInterface, attester string, user string, claim string) (*AttestationPath, error) {
+	key, err := APIstub.CreateCompositeKey(ATTESTATION_PATH, []string{attester, user, claim})
+	if err != nil {
+		return nil, err
+	}
+	pathAsBytes, err := APIstub.GetState(key)
+	if err != nil || pathAsBytes == nil {
+		return nil, err
+	}
+	path := AttestationPath{}
+	if err := json.Unmarshal(pathAsBytes, &path); err != nil {
+		return nil, err
+	}
+	return &path, nil
+}
+
+func getTrustRoot(APIstub shim.ChaincodeStubInterface, rootID string) (*TrustRoot, error) {
+	key, err := APIstub.CreateCompositeKey(TRUST_ROOT, []string{rootID})
+	if err != nil {
+		return nil, err
+	}
+	rootAsBytes, err := APIstub.GetState(key)
+	if err != nil || rootAsBytes == nil {
+		return nil, err
+	}
+	root := TrustRoot{}
+	if err := json.Unmarshal(rootAsBytes, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+func getAccreditation(APIstub shim.ChaincodeStubInterface, attester string, claim string) (*Accreditation, error) {
+	key, err := APIstub.CreateCompositeKey(ACCREDITATION, []string{attester, claim})
+	if err != nil {
+		return nil, err
+	}
+	accreditationAsBytes, err := APIstub.GetState(key)
+	if err != nil || accreditationAsBytes == nil {
+		return nil, err
+	}
+	accreditation := Accreditation{}
+	if err := json.Unmarshal(accreditationAsBytes, &accreditation); err != nil {
+		return nil, err
+	}
+	return &accreditation, nil
+}
+
+func putAccreditation(APIstub shim.ChaincodeStubInterface, accreditation Accreditation) error {
+	key, err := APIstub.CreateCompositeKey(ACCREDITATION, []string{accreditation.Attester, accreditation.Claim})
+	if err != nil {
+		return err
+	}
+	accreditationAsBytes, _ := json.Marshal(accreditation)
+	return APIstub.PutState(key, accreditationAsBytes)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// newTrustStub registers the root GOVERNMENT and accredits acme for fullname with one level of sub-accreditation
+func newTrustStub(t *testing.T) *testStub {
+	stub := newAttesterStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "branch", "Org2MSP")
+	stub.mustInvoke("registerTrustRoot", "GOVERNMENT", "Government")
+	stub.mustInvoke("accreditAttester", "GOVERNMENT", "acme", "fullname", "1", "0")
+	stub.as(TEST_ORG, "")
+	return stub
+}
+
+func queryTrustChain(t *testing.T, stub *testStub, args ...string) TrustVerdict {
+	t.Helper()
+	verdict := TrustVerdict{}
+	if err := json.Unmarshal(stub.mustInvoke("trustChain", args...), &verdict); err != nil {
+		t.Fatal(err)
+	}
+	return verdict
+}
+
+func TestAccreditAttester(t *testing.T) {
+	stub := newTrustStub(t)
+	if message := stub.mustFail("accreditAttester", "GOVERNMENT", "branch", "fullname", "0", "0"); message != "Only governance admins can call this function" {
+		t.Errorf("a client without role accredited under the root: %s", message)
+	}
+	stub.mustFail("accreditAttester", "acme", "unknown", "fullname", "0", "0")
+	if message := stub.mustFail("accreditAttester", "acme", "branch", "docid", "0", "0"); message != "acme is not accredited for docid" {
+		t.Errorf("unexpected error %s", message)
+	}
+	if message := stub.mustFail("accreditAttester", "acme", "branch", "fullname", "1", "0"); message != "acme can only accredit for fullname with a maxDepth below 1" {
+		t.Errorf("a sub-accreditation went deeper than its parent: %s", message)
+	}
+	// acme is registered with TEST_ORG, the org of branch has no say
+	stub.as("Org2MSP", "")
+	if message := stub.mustFail("accreditAttester", "acme", "branch", "fullname", "0", "0"); message != "Only Org1MSP can accredit on behalf of acme" {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("accreditAttester", "acme", "branch", "fullname", "0", "0")
+	if message := stub.mustFail("accreditAttester", "acme", "branch", "fullname", "0", "0"); message != "branch is already accredited for fullname, revoke the accreditation first" {
+		t.Errorf("an accreditation was overwritten: %s", message)
+	}
+
+	accreditations := []Accreditation{}
+	if err := json.Unmarshal(stub.mustInvoke("queryAccreditations", "branch"), &accreditations); err != nil {
+		t.Fatal(err)
+	}
+	if len(accreditations) != 1 || accreditations[0].Org != "Org2MSP" || len(accreditations[0].Path) != 3 {
+		t.Errorf("unexpected accreditations %+v", accreditations)
+	}
+}
+
+func TestTrustChain(t *testing.T) {
+	stub := newTrustStub(t)
+	stub.mustInvoke("accreditAttester", "acme", "branch", "fullname", "0", "0")
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("setKeyPolicy", "alice", "Org1MSP,Org2MSP")
+	stub.as(TEST_ORG, "")
+	stub.mustInvoke("requestAttestation", "branch", "alice", "fullname", "url")
+	stub.as("Org2MSP", "")
+	stub.mustInvoke("createAttestation", "branch", "alice", "fullname", "hash")
+
+	verdict := queryTrustChain(t, stub, "branch", "alice", "fullname", "GOVERNMENT")
+	if !verdict.Trusted || len(verdict.Path) != 3 || verdict.Path[1] != "acme" {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+	if verdict := queryTrustChain(t, stub, "branch", "alice", "fullname", "OTHER"); verdict.Trusted {
+		t.Errorf("the chain was trusted under another root: %+v", verdict)
+	}
+	if verdict := queryTrustChain(t, stub, "acme", "alice", "fullname", "GOVERNMENT"); verdict.Reason != "not attested" {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+
+	// revoking a link in the middle breaks the chain below it
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("revokeAccreditation", "acme", "fullname")
+	verdict = queryTrustChain(t, stub, "branch", "alice", "fullname", "GOVERNMENT")
+	if verdict.Trusted || verdict.Reason != "accreditation of acme by GOVERNMENT no longer holds" {
+		t.Errorf("a revoked accreditation was trusted: %+v", verdict)
+	}
+}
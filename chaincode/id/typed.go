@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Typed claim values. A claim is a string unless it is added with a type, its value is then kept
+ * in a canonical form (numbers without exponent, dates as YYYY-MM-DD, true or false, compact JSON
+ * with sorted keys) so every endorser validates and writes the same bytes.
+ * An array claim keeps its elements with an id each: elements are added and removed one at a
+ * time and an element can be attested on its own as the claim <claim>#<elementId>. The value of
+ * an array claim is the JSON array of its element values.
+ */
+
+// Types of claim values
+const (
+	CLAIM_STRING  = "string"
+	CLAIM_NUMBER  = "number"
+	CLAIM_DATE    = "date"
+	CLAIM_BOOLEAN = "boolean"
+	CLAIM_OBJECT  = "object"
+	CLAIM_ARRAY   = "array"
+)
+
+// DATE_FORMAT is the canonical form of date claims
+const DATE_FORMAT = "2006-01-02"
+
+// ELEMENT_SEP separates the claim from the element id in the name of an attested element
+const ELEMENT_SEP = "#"
+
+// ClaimElement is an element of an array claim, Type is empty for strings
+type ClaimElement struct {
+	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Added       int64  `json:"added"`
+	TxID        string `json:"txId"`
+	Attestation string `json:"attestation,omitempty"`
+}
+
+/*
+ * ADD CLAIM ELEMENT, appends an element to an array claim, creating the claim when the user has none
+ * args: 0 => (idClient), 1 => (ClaimName), 2 => (value), optional 3 => (type of the element, string by default)
+ * The value can be sent in the transient map ("value") instead of args[2].
+ * Returns the id of the element.
+ */
+func (s *SmartContract) addClaimElement(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	positional := len(args)
+	args, err := transientArgs(APIstub, args, 2, TRANSIENT_VALUE)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	private := len(args) != positional
+	if err := checkArgs("addClaimElement", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	typ := optionalArg(args, 3)
+	if typ == CLAIM_ARRAY {
+		return shim.Error("Elements of array claims must not be arrays")
+	}
+	value, err := normalizeValue(typ, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requirePrivateValues(APIstub, private); err != nil {
+		return shim.Error(err.Error())
+	}
+	elements, err := claimElements(APIstub, args[0], args[1], id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	element, err := newElement(APIstub, args[1], strconv.Itoa(len(elements)), typ, value)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setElements(APIstub, &id, args[0], args[1], append(elements, element)); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(element.ID))
+}
+
+/*
+ * REMOVE CLAIM ELEMENT from an array claim, the attestations of the element are removed from the
+ * attesters, the transaction then needs the endorsement of their orgs too
+ * args: 0 => (idClient), 1 => (ClaimName), 2 => (elementId)
+ */
+func (s *SmartContract) removeClaimElement(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+	if err := checkArgs("removeClaimElement", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	id, err := getID(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	elements, err := claimElements(APIstub, args[0], args[1], id)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	kept, removed := []ClaimElement{}, []ClaimElement{}
+	for _, element := range elements {
+		if element.ID != args[2] {
+			kept = append(kept, element)
+		} else {
+			removed = append(removed, element)
+		}
+	}
+	if len(removed) == 0 {
+		return shim.Error(fmt.Sprintf("Claim %s has no element %s", args[1], args[2]))
+	}
+	if err := dropElementAttestations(APIstub, args[0], args[1], removed); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setElements(APIstub, &id, args[0], args[1], kept); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putID(APIstub, args[0], id); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// claimType is the type of the value of claim, claims set without one are strings
+func claimType(claim Claim) string {
+	if claim.Type == "" {
+		return CLAIM_STRING
+	}
+	return claim.Type
+}
+
+/*
+ * setTypedClaim sets a claim of id to a value of type typ, encrypting the value and the elements
+ * when the transient map carries a "claimKey"
+ */
+func setTypedClaim(APIstub shim.ChaincodeStubInterface, id *ID, user string, name string, typ string, value string, elements []ClaimElement) error {
+	sealed, err := sealClaim(APIstub, user, name, value)
+	if err != nil {
+		return err
+	}
+	if err := setClaim(APIstub, id, name, sealed); err != nil {
+		return err
+	}
+	claim := id.Claims[name]
+	if typ != CLAIM_STRING {
+		claim.Type = typ
+	}
+	for _, element := range elements {
+		if element.Value, err = sealClaim(APIstub, user, name+ELEMENT_SEP+element.ID, element.Value); err != nil {
+			return err
+		}
+		claim.Elements = append(claim.Elements, element)
+	}
+	id.Claims[name] = claim
+	return nil
+}
+
+// setElements validates the elements as the value of an array claim and sets it
+func setElements(APIstub shim.ChaincodeStubInterface, id *ID, user string, name string, elements []ClaimElement) error {
+	value, err := elementsValue(elements)
+	if err != nil {
+		return err
+	}
+	if err := validateClaim(APIstub, name, CLAIM_ARRAY, value); err != nil {
+		return err
+	}
+	return setTypedClaim(APIstub, id, user, name, CLAIM_ARRAY, value, elements)
+}
+
+/*
+ * claimElements returns the decrypted elements of an array claim of the user, none when the user
+ * has no such claim yet
+ */
+func claimElements(APIstub shim.ChaincodeStubInterface, user string, name string, id ID) ([]ClaimElement, error) {
+	claim, exist := id.Claims[name]
+	if !exist {
+		return []ClaimElement{}, nil
+	}
+	if claim.Type != CLAIM_ARRAY {
+		return nil, fmt.Errorf("Claim %s is not an array", name)
+	}
+	key, err := transientClaimKey(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	claim, err = openTypedClaim(key, user, name, claim)
+	if err != nil {
+		return nil, err
+	}
+	return claim.Elements, nil
+}
+
+// newElement makes an element with the metadata of the transaction, seed tells apart the elements of a transaction
+func newElement(APIstub shim.ChaincodeStubInterface, name string, seed string, typ string, value string) (ClaimElement, error) {
+	now, err := txTime(APIstub)
+	if err != nil {
+		return ClaimElement{}, err
+	}
+	if typ == CLAIM_STRING {
+		typ = ""
+	}
+	return ClaimElement{
+		ID:     tokenSalt(APIstub.GetTxID(), name, seed)[:12],
+		Type:   typ,
+		Value:  value,
+		Source: SOURCE_SELF,
+		Added:  now,
+		TxID:   APIstub.GetTxID(),
+	}, nil
+}
+
+// newElements makes the elements of the canonical value of an array claim
+func newElements(APIstub shim.ChaincodeStubInterface, name string, value string) ([]ClaimElement, error) {
+	items := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, err
+	}
+	elements := make([]ClaimElement, 0, len(items))
+	for i, item := range items {
+		doc, err := decodeJSON(string(item))
+		if err != nil {
+			return nil, err
+		}
+		var typ, text string
+		switch v := doc.(type) {
+		case string:
+			typ, text = CLAIM_STRING, v
+		case json.Number:
+			typ, text = CLAIM_NUMBER, v.String()
+		case bool:
+			typ, text = CLAIM_BOOLEAN, strconv.FormatBool(v)
+		case map[string]interface{}:
+			typ, text = CLAIM_OBJECT, string(item)
+		default:
+			return nil, fmt.Errorf("Elements of array claims must not be arrays or null")
+		}
+		element, err := newElement(APIstub, name, strconv.Itoa(i), typ, text)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// elementsValue returns the JSON array of the (decrypted) element values
+func elementsValue(elements []ClaimElement) (string, error) {
+	items := make([]json.RawMessage, 0, len(elements))
+	for _, element := range elements {
+		switch element.Type {
+		case "", CLAIM_STRING, CLAIM_DATE:
+			item, _ := json.Marshal(element.Value)
+			items = append(items, item)
+		default:
+			items = append(items, json.RawMessage(element.Value))
+		}
+	}
+	value, err := json.Marshal(items)
+	return string(value), err
+}
+
+// normalizeValue checks that value is of type typ and returns its canonical form
+func normalizeValue(typ string, value string) (string, error) {
+	switch typ {
+	case "", CLAIM_STRING:
+		return value, nil
+	case CLAIM_NUMBER:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+			return "", fmt.Errorf("%q is not a number", value)
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case CLAIM_DATE:
+		date, err := time.Parse(DATE_FORMAT, strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%q is not a date (YYYY-MM-DD)", value)
+		}
+		return date.Format(DATE_FORMAT), nil
+	case CLAIM_BOOLEAN:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%q is not true or false", value)
+		}
+		return strconv.FormatBool(b), nil
+	case CLAIM_OBJECT, CLAIM_ARRAY:
+		doc, err := decodeJSON(value)
+		_, isObject := doc.(map[string]interface{})
+		_, isArray := doc.([]interface{})
+		if err != nil || (typ == CLAIM_OBJECT && !isObject) || (typ == CLAIM_ARRAY && !isArray) {
+			return "", fmt.Errorf("%q is not a JSON %s", value, typ)
+		}
+		// json.Marshal sorts the keys of objects
+		canonical, err := json.Marshal(doc)
+		return string(canonical), err
+	}
+	return "", fmt.Errorf("Claim type must be one of %s, %s, %s, %s, %s, %s", CLAIM_STRING, CLAIM_NUMBER, CLAIM_DATE, CLAIM_BOOLEAN, CLAIM_OBJECT, CLAIM_ARRAY)
+}
+
+// decodeJSON decodes value keeping numbers as they are written
+func decodeJSON(value string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("Trailing data after the JSON value")
+	}
+	return doc, nil
+}
+
+/*
+ * openTypedClaim decrypts the value and the elements of a claim of user, the key may only be nil
+ * when nothing is encrypted
+ */
+func openTypedClaim(key []byte, user string, name string, claim Claim) (Claim, error) {
+	if key == nil {
+		if encryptedClaim(claim) {
+			return claim, fmt.Errorf("The claimKey is needed to read the encrypted claim %s", name)
+		}
+		return claim, nil
+	}
+	value, err := openClaim(key, user, name, claim.Value)
+	if err != nil {
+		return claim, err
+	}
+	claim.Value = value
+	elements := make([]ClaimElement, len(claim.Elements))
+	for i, element := range claim.Elements {
+		if element.Value, err = openClaim(key, user, name+ELEMENT_SEP+element.ID, element.Value); err != nil {
+			return claim, err
+		}
+		elements[i] = element
+	}
+	if len(elements) > 0 {
+		claim.Elements = elements
+	}
+	return claim, nil
+}
+
+// resealClaim encrypts an encrypted claim of from for the user to
+func resealClaim(APIstub shim.ChaincodeStubInterface, key []byte, from string, to string, name string, claim Claim) (Claim, error) {
+	if !encryptedClaim(claim) {
+		return claim, nil
+	}
+	if key == nil {
+		return claim, fmt.Errorf("The claimKey is needed to move the encrypted claim %s", name)
+	}
+	claim, err := openTypedClaim(key, from, name, claim)
+	if err != nil {
+		return claim, err
+	}
+	if claim.Value, err = sealClaim(APIstub, to, name, claim.Value); err != nil {
+		return claim, err
+	}
+	for i, element := range claim.Elements {
+		if claim.Elements[i].Value, err = sealClaim(APIstub, to, name+ELEMENT_SEP+element.ID, element.Value); err != nil {
+			return claim, err
+		}
+	}
+	return claim, nil
+}
+
+func encryptedClaim(claim Claim) bool {
+	if strings.HasPrefix(claim.Value, ENCRYPTED) {
+		return true
+	}
+	for _, element := range claim.Elements {
+		if strings.HasPrefix(element.Value, ENCRYPTED) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitElement splits the name of an attested element into the claim and the element id
+func splitElement(name string) (string, string) {
+	if i := strings.Index(name, ELEMENT_SEP); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+/*
+ * dropElementAttestations removes the attestations of elements of the claim name of user from
+ * the documents of their attesters, with their accreditation paths. The element ids are not
+ * reused, but an attestation must not outlive the element it was given for.
+ */
+func dropElementAttestations(APIstub shim.ChaincodeStubInterface, user string, name string, elements []ClaimElement) error {
+	for _, element := range elements {
+		if err := dropAttestation(APIstub, user, name+ELEMENT_SEP+element.ID, element.Attestation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * dropAttestation removes the attestation of the claim, or element <claim>#<elementId>, of user
+ * from the document of its attester with its accreditation path, nothing is done when it is self
+ * asserted
+ */
+func dropAttestation(APIstub shim.ChaincodeStubInterface, user string, claim string, attestation string) error {
+	if !strings.HasPrefix(attestation, ATTEST) {
+		return nil
+	}
+	attester := strings.TrimPrefix(attestation, ATTEST)
+	attestations, err := getAttestClaim(APIstub, attestation)
+	if err != nil {
+		return err
+	}
+	if _, exist := attestations.Claim[user][claim]; exist {
+		delete(attestations.Claim[user], claim)
+		if len(attestations.Claim[user]) == 0 {
+			delete(attestations.Claim, user)
+		}
+		if err := putAttestClaim(APIstub, attestation, attestations); err != nil {
+			return err
+		}
+	}
+	return clearAttestationPath(APIstub, attester, user, claim)
+}
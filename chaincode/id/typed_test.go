@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+)
+
+// attested reports whether the attester document of acme holds the claim of alice
+func attested(stub *testStub, claim string) bool {
+	stub.t.Helper()
+	attestations, err := getAttestClaim(stub, ATTEST+"acme")
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+	_, exist := attestations.Claim["alice"][claim]
+	return exist
+}
+
+func attest(stub *testStub, claim string) {
+	stub.t.Helper()
+	stub.mustInvoke("requestAttestation", "acme", "alice", claim, "url")
+	stub.mustInvoke("createAttestation", "acme", "alice", claim, "hash")
+}
+
+func TestTypedClaimValues(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "birthdate", "", `{"type": "string"}`, SENSITIVITY_LOW, "", "0")
+	stub.mustInvoke("registerClaimSchema", "address", "", `{"type": "object"}`, SENSITIVITY_LOW, "", "0")
+	stub.as(TEST_ORG, "")
+	stub.createID("alice", "P1")
+
+	stub.with(TRANSIENT_VALUE, "2000-02-30")
+	stub.mustFail("addClaim", "alice", "birthdate", CLAIM_DATE)
+	stub.with(TRANSIENT_VALUE, "2000-02-29")
+	stub.mustInvoke("addClaim", "alice", "birthdate", CLAIM_DATE)
+	stub.with(TRANSIENT_VALUE, `{"zip": "1000", "city": "Brussels"}`)
+	stub.mustInvoke("addClaim", "alice", "address", CLAIM_OBJECT)
+	if claim := stub.getID("alice").Claims["address"]; claim.Type != CLAIM_OBJECT || claim.Value != `{"city":"Brussels","zip":"1000"}` {
+		t.Errorf("the object was not kept in its canonical form: %+v", claim)
+	}
+	stub.with(TRANSIENT_VALUE, "x")
+	stub.mustFail("addClaim", "alice", "address", "list")
+}
+
+func TestClaimElements(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerClaimSchema", "phones", "", `{"type": "array"}`, SENSITIVITY_LOW, "", "0")
+	stub.as(TEST_ORG, "")
+	stub.with(TRANSIENT_VALUE, "555")
+	first := string(stub.mustInvoke("addClaimElement", "alice", "phones"))
+	stub.with(TRANSIENT_VALUE, "556")
+	second := string(stub.mustInvoke("addClaimElement", "alice", "phones"))
+	if claim := stub.getID("alice").Claims["phones"]; claim.Value != `["555","556"]` || len(claim.Elements) != 2 {
+		t.Fatalf("unexpected claim %+v", claim)
+	}
+
+	element := "phones" + ELEMENT_SEP + first
+	attest(stub, element)
+	if claim := stub.getID("alice").Claims["phones"]; claim.Elements[0].Attestation != ATTEST+"acme" || claim.Attestation != "" {
+		t.Errorf("the attestation of the element was not linked to it: %+v", claim)
+	}
+
+	if message := stub.mustFail("removeClaimElement", "alice", "phones", "nope"); message != "Claim phones has no element nope" {
+		t.Errorf("unexpected error %s", message)
+	}
+	stub.mustInvoke("removeClaimElement", "alice", "phones", first)
+	if attested(stub, element) {
+		t.Errorf("the attestation outlived its element")
+	}
+	if claim := stub.getID("alice").Claims["phones"]; claim.Value != `["556"]` || claim.Elements[0].ID != second {
+		t.Errorf("unexpected claim %+v", claim)
+	}
+}
+
+func TestReplacedClaimDropsItsAttestation(t *testing.T) {
+	stub := newAttesterStub(t)
+	attest(stub, "fullname")
+
+	// the same value keeps its attestation
+	stub.with(TRANSIENT_VALUE, "Name of alice")
+	stub.mustInvoke("addClaim", "alice", "fullname")
+	if claim := stub.getID("alice").Claims["fullname"]; claim.Attestation != ATTEST+"acme" || !attested(stub, "fullname") {
+		t.Errorf("the attestation of an unchanged value was dropped: %+v", claim)
+	}
+
+	stub.with(TRANSIENT_VALUE, "Alice")
+	stub.mustInvoke("addClaim", "alice", "fullname")
+	if claim := stub.getID("alice").Claims["fullname"]; claim.Attestation != "" || claim.Source != SOURCE_SELF {
+		t.Errorf("unexpected claim %+v", claim)
+	}
+	if attested(stub, "fullname") {
+		t.Errorf("the attester still vouches for the replaced value")
+	}
+	if verdict := queryVerdict(t, stub, "alice", "fullname", "acme"); verdict.Verified {
+		t.Errorf("the replaced value was verified: %+v", verdict)
+	}
+}
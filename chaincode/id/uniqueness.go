@@ -0,0 +1,656 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Uniqueness of document numbers: every docid is indexed under its HMAC with a secret key, so the
+ * index tells which identity holds a passport or national ID number without exposing the number
+ * itself. The key is set once by governance admins and only kept in the private data collection
+ * of the member orgs, document numbers have too little entropy to be hashed with a public salt.
+ * When another identity registers a number that is already held, the identity is still written
+ * but a conflict is opened: its docid can not be attested until an attester accredited for docid
+ * or a governance admin decides which identity keeps the number. The docid claim of the other one
+ * is removed.
+ */
+
+// PRIVATE_COLLECTION is the private data collection of the member orgs, see collections_config.json
+const PRIVATE_COLLECTION = "identityPrivate"
+
+// Composite key prefixes of the docid index
+const (
+	DOC_SALT     = "docIndexSalt"
+	DOC_INDEX    = "docIndex~hash"
+	DOC_CONFLICT = "docConflict~claimant~conflictId"
+)
+
+// TRANSIENT_DOC_INDEX_KEY is the transient map key carrying the secret key of the docid index
+const TRANSIENT_DOC_INDEX_KEY = "docIndexKey"
+
+// Statuses and decisions of a docid conflict
+const (
+	CONFLICT_OPEN     = "open"
+	CONFLICT_RESOLVED = "resolved"
+	DECIDE_HOLDER     = "holder"
+	DECIDE_CLAIMANT   = "claimant"
+)
+
+// DocIndexEntry is the identity holding a document number
+type DocIndexEntry struct {
+	User string `json:"user"`
+	TxID string `json:"txId"`
+}
+
+// DocConflict is a document number registered by Claimant while Holder held it
+type DocConflict struct {
+	ConflictID string `json:"conflictId"`
+	DocHash    string `json:"docHash"`
+	Holder     string `json:"holder"`
+	Claimant   string `json:"claimant"`
+	Status     string `json:"status"`
+	Opened     int64  `json:"opened"`
+	Decision   string `json:"decision,omitempty"`
+	ResolvedBy string `json:"resolvedBy,omitempty"`
+	Resolved   int64  `json:"resolved,omitempty"`
+}
+
+/*
+ * dropPublicDocIndex removes the salt earlier versions kept in world state together with the
+ * index entries hashed with it, indexDocIDs rebuilds the index once the key is set
+ */
+func dropPublicDocIndex(APIstub shim.ChaincodeStubInterface) error {
+	key, err := APIstub.CreateCompositeKey(DOC_SALT, []string{})
+	if err != nil {
+		return err
+	}
+	saltAsBytes, err := APIstub.GetState(key)
+	if err != nil || saltAsBytes == nil {
+		return err
+	}
+	if err := APIstub.DelState(key); err != nil {
+		return err
+	}
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(DOC_INDEX, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		if err := APIstub.DelState(queryResponse.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * SET DOCID INDEX KEY (governance admins only), the 32 bytes secret key of the docid index is sent
+ * in the transient map ("docIndexKey") and kept in the private data collection. It can only be
+ * set once, the index entries are hashed with it.
+ * args: none
+ */
+func (s *SmartContract) setDocIndexKey(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("setDocIndexKey", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	transient, err := APIstub.GetTransient()
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	secret := transient[TRANSIENT_DOC_INDEX_KEY]
+	if len(secret) != 32 {
+		return shim.Error("The docid index key must be 32 bytes sent in the transient map")
+	}
+	key, err := APIstub.CreateCompositeKey(DOC_SALT, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	existing, err := APIstub.GetPrivateData(PRIVATE_COLLECTION, key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if existing != nil {
+		return shim.Error("The docid index key is already set")
+	}
+	if err := APIstub.PutPrivateData(PRIVATE_COLLECTION, key, secret); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+// docHash is the index hash of a document number, spaces, dashes and case do not matter
+func docHash(APIstub shim.ChaincodeStubInterface, docid string) (string, error) {
+	key, err := APIstub.CreateCompositeKey(DOC_SALT, []string{})
+	if err != nil {
+		return "", err
+	}
+	salt, err := APIstub.GetPrivateData(PRIVATE_COLLECTION, key)
+	if err != nil {
+		return "", err
+	}
+	if salt == nil {
+		return "", fmt.Errorf("The docid index key is not set, see setDocIndexKey")
+	}
+	normalized := strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(docid))
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+/*
+ * docBatch are the index entries and conflicts written by the current transaction, which does
+ * not read its own writes. Callers indexing several docids in one transaction share a batch.
+ */
+type docBatch struct {
+	holders   map[string]string
+	conflicts map[string]bool
+}
+
+func newDocBatch() *docBatch {
+	return &docBatch{holders: map[string]string{}, conflicts: map[string]bool{}}
+}
+
+/*
+ * indexDocID records that user holds docid. When another identity holds it a conflict is opened
+ * and its id returned, an empty string otherwise or when the conflict is already open.
+ */
+func indexDocID(APIstub shim.ChaincodeStubInterface, batch *docBatch, user string, docid string) (string, error) {
+	hash, err := docHash(APIstub, docid)
+	if err != nil {
+		return "", err
+	}
+	holder, written := batch.holders[hash]
+	if !written {
+		entry, err := getDocIndexEntry(APIstub, hash)
+		if err != nil {
+			return "", err
+		}
+		if entry != nil && entry.User != user {
+			if holder, err = currentHolder(APIstub, entry.User); err != nil {
+				return "", err
+			}
+		}
+	}
+	if holder != "" && holder != user {
+		return openDocConflict(APIstub, batch, hash, holder, user)
+	}
+	batch.holders[hash] = user
+	return "", putDocIndexEntry(APIstub, hash, user)
+}
+
+/*
+ * releaseDocID removes docid from the index when user holds it, e.g. when the docid of user changes
+ */
+func releaseDocID(APIstub shim.ChaincodeStubInterface, user string, docid string) error {
+	hash, err := docHash(APIstub, docid)
+	if err != nil {
+		return err
+	}
+	entry, err := getDocIndexEntry(APIstub, hash)
+	if err != nil || entry == nil || entry.User != user {
+		return err
+	}
+	key, err := APIstub.CreateCompositeKey(DOC_INDEX, []string{hash})
+	if err != nil {
+		return err
+	}
+	return APIstub.DelState(key)
+}
+
+/*
+ * changeDocID moves the index entry of user from its previous stored docid to docid, see indexDocID
+ */
+func changeDocID(APIstub shim.ChaincodeStubInterface, user string, previous string, docid string) (string, error) {
+	if strings.HasPrefix(previous, ENCRYPTED) {
+		key, err := transientClaimKey(APIstub)
+		if err != nil {
+			return "", err
+		}
+		sealed := previous
+		// without the key the previous entry stays until a conflict about it is resolved
+		previous = ""
+		if key != nil {
+			if plain, err := openClaim(key, user, "docid", sealed); err == nil {
+				previous = plain
+			}
+		}
+	}
+	if previous != "" {
+		if err := releaseDocID(APIstub, user, previous); err != nil {
+			return "", err
+		}
+	}
+	return indexDocID(APIstub, newDocBatch(), user, docid)
+}
+
+/*
+ * currentHolder is the identity an index entry of user stands for now: its survivor when it was
+ * merged, empty when it was removed
+ */
+func currentHolder(APIstub shim.ChaincodeStubInterface, user string) (string, error) {
+	holder, err := followRedirects(APIstub, user)
+	if err != nil {
+		return "", err
+	}
+	idAsBytes, err := APIstub.GetState(holder)
+	if err != nil || idAsBytes == nil {
+		return "", err
+	}
+	return holder, nil
+}
+
+/*
+ * openDocConflict opens a conflict between holder and claimant about hash, unless they already
+ * have an open one
+ */
+func openDocConflict(APIstub shim.ChaincodeStubInterface, batch *docBatch, hash string, holder string, claimant string) (string, error) {
+	pair := hash + "\x00" + holder + "\x00" + claimant
+	if batch.conflicts[pair] {
+		return "", nil
+	}
+	batch.conflicts[pair] = true
+	conflicts, err := listDocConflicts(APIstub, []string{claimant})
+	if err != nil {
+		return "", err
+	}
+	for _, conflict := range conflicts {
+		if conflict.Status == CONFLICT_OPEN && conflict.Holder == holder && conflict.DocHash == hash {
+			return "", nil
+		}
+	}
+	opened, err := txTime(APIstub)
+	if err != nil {
+		return "", err
+	}
+	conflict := DocConflict{
+		ConflictID: tokenSalt(DOC_CONFLICT, APIstub.GetTxID(), claimant, holder),
+		DocHash:    hash,
+		Holder:     holder,
+		Claimant:   claimant,
+		Status:     CONFLICT_OPEN,
+		Opened:     opened,
+	}
+	if err := putDocConflict(APIstub, conflict); err != nil {
+		return "", err
+	}
+	return conflict.ConflictID, nil
+}
+
+/*
+ * requireNoDocConflict refuses to attest the docid of a user while a conflict about it is open
+ */
+func requireNoDocConflict(APIstub shim.ChaincodeStubInterface, user string, claim string) error {
+	if claim != "docid" {
+		return nil
+	}
+	conflicts, err := listDocConflicts(APIstub, []string{user})
+	if err != nil {
+		return err
+	}
+	for _, conflict := range conflicts {
+		if conflict.Status == CONFLICT_OPEN {
+			return fmt.Errorf("The docid of %s is in conflict %s", user, conflict.ConflictID)
+		}
+	}
+	return nil
+}
+
+/*
+ * QUERY DOCID CONFLICTS that are still open
+ * args: 0 => (claimant idClient, optional, all claimants when left out)
+ */
+func (s *SmartContract) queryDocConflicts(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("queryDocConflicts", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	keys := []string{}
+	if claimant := optionalArg(args, 0); claimant != "" {
+		keys = append(keys, claimant)
+	}
+	conflicts, err := listDocConflicts(APIstub, keys)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	open := []DocConflict{}
+	for _, conflict := range conflicts {
+		if conflict.Status == CONFLICT_OPEN {
+			open = append(open, conflict)
+		}
+	}
+	conflictsAsBytes, _ := json.Marshal(open)
+	return shim.Success(conflictsAsBytes)
+}
+
+/*
+ * RESOLVE DOCID CONFLICT, a governance admin or a client of the org of an attester accredited for
+ * docid decides which identity keeps the number. Merged identities stand for their survivor. The
+ * other identity loses its docid claim only when it still holds the number, an encrypted docid is
+ * only checked, and removed, when the transient map carries its "claimKey".
+ * args: 0 => (claimant idClient), 1 => (conflictId), 2 => (idAttester), 3 => (decision, holder or claimant)
+ */
+func (s *SmartContract) resolveDocConflict(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("resolveDocConflict", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := requireDocAttester(APIstub, args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	conflict, err := getDocConflict(APIstub, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if conflict == nil || conflict.Status != CONFLICT_OPEN {
+		return shim.Error(fmt.Sprintf("Open conflict %s not Found!", args[1]))
+	}
+
+	keeper, loser := conflict.Holder, conflict.Claimant
+	switch args[3] {
+	case DECIDE_HOLDER:
+	case DECIDE_CLAIMANT:
+		keeper, loser = conflict.Claimant, conflict.Holder
+	default:
+		return shim.Error(fmt.Sprintf("decision must be %s or %s", DECIDE_HOLDER, DECIDE_CLAIMANT))
+	}
+	holder, err := currentHolder(APIstub, keeper)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if holder != "" {
+		keeper = holder
+	}
+	if err := putDocIndexEntry(APIstub, conflict.DocHash, keeper); err != nil {
+		return shim.Error(err.Error())
+	}
+	// the identity that lost the number no longer claims it, unless its docid changed since
+	if loser, err = currentHolder(APIstub, loser); err != nil {
+		return shim.Error(err.Error())
+	}
+	if loser != "" && loser != keeper {
+		claimKey, err := transientClaimKey(APIstub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		id, err := getID(APIstub, loser)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		holds, err := holdsDocHash(APIstub, claimKey, loser, id, conflict.DocHash)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if holds {
+			delete(id.Claims, "docid")
+			if err := putID(APIstub, loser, id); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	conflict.Status = CONFLICT_RESOLVED
+	conflict.Decision = args[3]
+	conflict.ResolvedBy = args[2]
+	conflict.Resolved = now
+	if err := putDocConflict(APIstub, *conflict); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+/*
+ * holdsDocHash reports whether the docid of the identity hashes to hash. An encrypted docid the
+ * claimKey does not open is taken as a different number.
+ */
+func holdsDocHash(APIstub shim.ChaincodeStubInterface, claimKey []byte, user string, id ID, hash string) (bool, error) {
+	docid, ok := plainDocID(claimKey, user, id)
+	if !ok {
+		return false, nil
+	}
+	held, err := docHash(APIstub, docid)
+	return held == hash, err
+}
+
+// plainDocID is the docid of the identity, false when it has none or it is encrypted and claimKey does not open it
+func plainDocID(claimKey []byte, user string, id ID) (string, bool) {
+	claim, exist := id.Claims["docid"]
+	if !exist {
+		return "", false
+	}
+	if !strings.HasPrefix(claim.Value, ENCRYPTED) {
+		return claim.Value, true
+	}
+	if claimKey == nil {
+		return "", false
+	}
+	docid, err := openClaim(claimKey, user, "docid", claim.Value)
+	return docid, err == nil
+}
+
+/*
+ * mergeDocIndexEntry hands the index entry of the docid of merged to the survivor when the survivor
+ * holds the same number and removes it otherwise. The entry of an encrypted docid the claimKey does
+ * not open stays, currentHolder takes it for the survivor.
+ */
+func mergeDocIndexEntry(APIstub shim.ChaincodeStubInterface, claimKey []byte, survivor string, survivorID ID, merged string, mergedID ID) error {
+	docid, ok := plainDocID(claimKey, merged, mergedID)
+	if !ok {
+		return nil
+	}
+	hash, err := docHash(APIstub, docid)
+	if err != nil {
+		return err
+	}
+	entry, err := getDocIndexEntry(APIstub, hash)
+	if err != nil || entry == nil || entry.User != merged {
+		return err
+	}
+	holds, err := holdsDocHash(APIstub, claimKey, survivor, survivorID, hash)
+	if err != nil {
+		return err
+	}
+	if holds {
+		return putDocIndexEntry(APIstub, hash, survivor)
+	}
+	key, err := APIstub.CreateCompositeKey(DOC_INDEX, []string{hash})
+	if err != nil {
+		return err
+	}
+	return APIstub.DelState(key)
+}
+
+/*
+ * requireDocAttester checks the caller is a governance admin or a client of the org of attester,
+ * and that attester is allowed to attest docid and holds a valid accreditation for it
+ */
+func requireDocAttester(APIstub shim.ChaincodeStubInterface, attester string) error {
+	if requireRole(APIstub, GOVERNANCE) == nil {
+		return nil
+	}
+	if err := validateAttestationRequest(APIstub, "docid", attester); err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	accreditation, err := getAccreditation(APIstub, attester, "docid")
+	if err != nil {
+		return err
+	}
+	if accreditation == nil || !accreditation.valid(now) {
+		return fmt.Errorf("%s is not accredited for docid", attester)
+	}
+	org, err := cid.GetMSPID(APIstub)
+	if err != nil {
+		return err
+	}
+	if org != accreditation.Org {
+		return fmt.Errorf("Only clients of %s can act as %s", accreditation.Org, attester)
+	}
+	return nil
+}
+
+/*
+ * INDEX DOCIDS (governance admins only), adds the docid of identities written before the index
+ * existed, at most limit keys from startKey. Encrypted docids are indexed when the transient map
+ * carries their "claimKey".
+ * args: 0 => (startKey, empty for the first key), 1 => (limit)
+ * Returns {"indexed": n, "conflicts": [...], "next": "..."}, next is empty once all keys are done.
+ */
+func (s *SmartContract) indexDocIDs(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("indexDocIDs", args); err != nil {
+		return shim.Error(err.Error())
+	}
+	limit, err := strconv.Atoi(args[1])
+	if err != nil || limit <= 0 {
+		return shim.Error("limit must be a positive number")
+	}
+	claimKey, err := transientClaimKey(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := APIstub.GetStateByRange(args[0], "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	batch := newDocBatch()
+	indexed, conflicts, next := 0, []string{}, ""
+	for count := 0; resultsIterator.HasNext(); count++ {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if count == limit {
+			next = queryResponse.Key
+			break
+		}
+		if recordKind(queryResponse.Key) != RECORD_ID {
+			continue
+		}
+		id, err := decodeID(queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		claim, exist := id.Claims["docid"]
+		docid := claim.Value
+		if !exist || id.RedirectTo != "" {
+			continue
+		}
+		if strings.HasPrefix(docid, ENCRYPTED) {
+			if claimKey == nil {
+				continue
+			}
+			if docid, err = openClaim(claimKey, queryResponse.Key, "docid", docid); err != nil {
+				continue
+			}
+		}
+		conflict, err := indexDocID(APIstub, batch, queryResponse.Key, docid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if conflict != "" {
+			conflicts = append(conflicts, conflict)
+		}
+		indexed++
+	}
+
+	resultAsBytes, _ := json.Marshal(map[string]interface{}{"indexed": indexed, "conflicts": conflicts, "next": next})
+	return shim.Success(resultAsBytes)
+}
+
+func getDocIndexEntry(APIstub shim.ChaincodeStubInterface, hash string) (*DocIndexEntry, error) {
+	key, err := APIstub.CreateCompositeKey(DOC_INDEX, []string{hash})
+	if err != nil {
+		return nil, err
+	}
+	entryAsBytes, err := APIstub.GetState(key)
+	if err != nil || entryAsBytes == nil {
+		return nil, err
+	}
+	entry := DocIndexEntry{}
+	if err := json.Unmarshal(entryAsBytes, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func putDocIndexEntry(APIstub shim.ChaincodeStubInterface, hash string, user string) error {
+	key, err := APIstub.CreateCompositeKey(DOC_INDEX, []string{hash})
+	if err != nil {
+		return err
+	}
+	entryAsBytes, _ := json.Marshal(DocIndexEntry{User: user, TxID: APIstub.GetTxID()})
+	return APIstub.PutState(key, entryAsBytes)
+}
+
+func getDocConflict(APIstub shim.ChaincodeStubInterface, claimant string, conflictID string) (*DocConflict, error) {
+	key, err := APIstub.CreateCompositeKey(DOC_CONFLICT, []string{claimant, conflictID})
+	if err != nil {
+		return nil, err
+	}
+	conflictAsBytes, err := APIstub.GetState(key)
+	if err != nil || conflictAsBytes == nil {
+		return nil, err
+	}
+	conflict := DocConflict{}
+	if err := json.Unmarshal(conflictAsBytes, &conflict); err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+func putDocConflict(APIstub shim.ChaincodeStubInterface, conflict DocConflict) error {
+	key, err := APIstub.CreateCompositeKey(DOC_CONFLICT, []string{conflict.Claimant, conflict.ConflictID})
+	if err != nil {
+		return err
+	}
+	conflictAsBytes, _ := json.Marshal(conflict)
+	return APIstub.PutState(key, conflictAsBytes)
+}
+
+func listDocConflicts(APIstub shim.ChaincodeStubInterface, keys []string) ([]DocConflict, error) {
+	resultsIterator, err := APIstub.GetStateByPartialCompositeKey(DOC_CONFLICT, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	conflicts := []DocConflict{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		conflict := DocConflict{}
+		if err := json.Unmarshal(queryResponse.Value, &conflict); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func queryConflicts(t *testing.T, stub *testStub, args ...string) []DocConflict {
+	t.Helper()
+	conflicts := []DocConflict{}
+	if err := json.Unmarshal(stub.mustInvoke("queryDocConflicts", args...), &conflicts); err != nil {
+		t.Fatal(err)
+	}
+	return conflicts
+}
+
+func TestSetDocIndexKey(t *testing.T) {
+	stub := newTestStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.with(TRANSIENT_DOC_INDEX_KEY, strings.Repeat("x", 32))
+	if message := stub.mustFail("setDocIndexKey"); message != "The docid index key is already set" {
+		t.Errorf("the key was replaced: %s", message)
+	}
+	for key := range stub.State {
+		if strings.HasPrefix(key, "\x00"+DOC_SALT) {
+			t.Errorf("the docid index key is in world state")
+		}
+	}
+}
+
+func TestDocConflict(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P-1")
+	if conflicts := queryConflicts(t, stub); len(conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+	// the same number, written another way
+	stub.createID("bob", "p1")
+	conflicts := queryConflicts(t, stub, "bob")
+	if len(conflicts) != 1 || conflicts[0].Holder != "alice" || conflicts[0].Claimant != "bob" {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+	for key := range stub.State {
+		if strings.Contains(key, "p1") || strings.Contains(key, "P-1") {
+			t.Errorf("the document number is in a key: %q", key)
+		}
+	}
+
+	if err := requireNoDocConflict(stub, "bob", "docid"); err == nil {
+		t.Errorf("the docid of bob can be attested during the conflict")
+	}
+	conflict := conflicts[0].ConflictID
+	if message := stub.mustFail("resolveDocConflict", "bob", conflict, "attester", DECIDE_CLAIMANT); !strings.Contains(message, "attester") {
+		t.Errorf("resolved by a client that is not an attester: %s", message)
+	}
+
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustFail("resolveDocConflict", "bob", conflict, "governance", "both")
+	stub.mustInvoke("resolveDocConflict", "bob", conflict, "governance", DECIDE_CLAIMANT)
+	if _, exist := stub.getID("alice").Claims["docid"]; exist {
+		t.Errorf("alice kept the docid it lost")
+	}
+	if _, exist := stub.getID("bob").Claims["docid"]; !exist {
+		t.Errorf("bob lost the docid it kept")
+	}
+	if conflicts := queryConflicts(t, stub); len(conflicts) != 0 {
+		t.Errorf("the conflict is still open: %+v", conflicts)
+	}
+	stub.mustFail("resolveDocConflict", "bob", conflict, "governance", DECIDE_HOLDER)
+
+	// the number is now held by bob
+	stub.createID("carol", "P1")
+	if conflicts := queryConflicts(t, stub, "carol"); len(conflicts) != 1 || conflicts[0].Holder != "bob" {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+}
+
+// docIndexHolder is the identity the index entry of docid names, empty when there is none
+func docIndexHolder(t *testing.T, stub *testStub, docid string) string {
+	t.Helper()
+	hash, err := docHash(stub, docid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := getDocIndexEntry(stub, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		return ""
+	}
+	return entry.User
+}
+
+func mergeInto(stub *testStub, survivor string, merged string) {
+	stub.t.Helper()
+	for _, pair := range [][]string{{survivor, merged}, {merged, survivor}} {
+		stub.with(TRANSIENT_SECRET, pair[0])
+		stub.mustInvoke("linkIdentities", pair...)
+	}
+	stub.with(TRANSIENT_SECRET, merged)
+	stub.mustInvoke("mergeIdentities", survivor, merged)
+}
+
+func TestDocIndexOfMergedIdentity(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.createID("bob", "P2")
+	mergeInto(stub, "bob", "alice")
+
+	// bob kept its own number, the one of alice is free again
+	if holder := docIndexHolder(t, stub, "P1"); holder != "" {
+		t.Errorf("the number alice held is still indexed for %s", holder)
+	}
+	stub.createID("carol", "P1")
+	if conflicts := queryConflicts(t, stub, "carol"); len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+
+	// the same number written another way goes to the survivor
+	stub.createID("erin", "P3")
+	stub.createID("frank", "p-3")
+	mergeInto(stub, "frank", "erin")
+	if holder := docIndexHolder(t, stub, "P3"); holder != "frank" {
+		t.Errorf("the number is indexed for %s", holder)
+	}
+	stub.createID("gina", "P3")
+	if conflicts := queryConflicts(t, stub, "gina"); len(conflicts) != 1 || conflicts[0].Holder != "frank" {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+
+	// a removed holder no longer holds its number
+	stub.mustInvoke("removeUser", "bob")
+	stub.createID("dave", "P2")
+	if conflicts := queryConflicts(t, stub, "dave"); len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+}
+
+func TestResolveDocConflictKeepsChangedDocID(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.createID("bob", "P1")
+	conflict := queryConflicts(t, stub, "bob")[0].ConflictID
+
+	// bob corrected its number before the conflict was resolved
+	stub.with(TRANSIENT_VALUE, "P9")
+	stub.mustInvoke("addClaim", "bob", "docid")
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("resolveDocConflict", "bob", conflict, "governance", DECIDE_HOLDER)
+	if docid := stub.getID("bob").Claims["docid"].Value; docid != "P9" {
+		t.Errorf("bob lost the number it holds now: %q", docid)
+	}
+	if holder := docIndexHolder(t, stub, "P1"); holder != "alice" {
+		t.Errorf("the number is indexed for %s", holder)
+	}
+}
+
+func TestResolveDocConflictWithMergedClaimant(t *testing.T) {
+	stub := newTestStub(t)
+	stub.createID("alice", "P1")
+	stub.createID("bob", "P1")
+	stub.createID("carol", "P2")
+	conflict := queryConflicts(t, stub, "bob")[0].ConflictID
+	// carol keeps its own number, bob's P1 was dropped with the merge
+	mergeInto(stub, "carol", "bob")
+
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("resolveDocConflict", "bob", conflict, "governance", DECIDE_HOLDER)
+	if docid := stub.getID("carol").Claims["docid"].Value; docid != "P2" {
+		t.Errorf("the survivor lost a number that was not in conflict: %q", docid)
+	}
+	if _, exist := stub.getID("alice").Claims["docid"]; !exist {
+		t.Errorf("alice lost the number it kept")
+	}
+}
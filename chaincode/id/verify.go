@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+/*
+ * Verification API for other chaincodes. It is read only and its arguments and verdict will not
+ * change between releases, so contracts can call it with
+ *
+ *	APIstub.InvokeChaincode("id", [][]byte{[]byte("isClaimVerified"), []byte(user), []byte(claim), []byte(attesters), []byte(root)}, "")
+ *
+ * and check the "verified" field of the payload. A claim is only verified against the attesters
+ * or the trust root the caller names, an attestation by anyone else proves nothing.
+ */
+
+// Verdict is the answer of isClaimVerified
+type Verdict struct {
+	User     string `json:"user"`
+	Claim    string `json:"claim"`
+	Verified bool   `json:"verified"`
+	Attester string `json:"attester,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+/*
+ * IS CLAIM VERIFIED, whether the user has the claim and one of the attesters, or an attester
+ * accredited under the trust root, attested its current value. Attesters or a root are required.
+ * args: 0 => (idClient), 1 => (ClaimName), 2 => (attesters, comma separated),
+ *       optional 3 => (trust root id, see trustChain)
+ */
+func (s *SmartContract) isClaimVerified(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if err := checkArgs("isClaimVerified", args); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	attesters, root := splitList(args[2]), optionalArg(args, 3)
+	if len(attesters) == 0 && root == "" {
+		return shim.Error("The attesters or the trust root to verify the claim with are required")
+	}
+	verdict, err := verifyClaim(APIstub, args[0], args[1], attesters, root)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	verdictAsBytes, _ := json.Marshal(verdict)
+	return shim.Success(verdictAsBytes)
+}
+
+// verifyClaim checks the attestation of the claim against the attesters when given, and its trust chain to root when given
+func verifyClaim(APIstub shim.ChaincodeStubInterface, user string, claim string, attesters []string, root string) (Verdict, error) {
+	verdict := Verdict{User: user, Claim: claim}
+
+	idAsBytes, err := APIstub.GetState(user)
+	if err != nil {
+		return verdict, err
+	}
+	if idAsBytes == nil {
+		verdict.Reason = "unknown user"
+		return verdict, nil
+	}
+	id, err := decodeID(user, idAsBytes)
+	if err != nil {
+		return verdict, err
+	}
+	source, attestation, exist := claimAttestation(id, claim)
+	if !exist {
+		verdict.Reason = "no such claim"
+		return verdict, nil
+	}
+
+	// only the attestation the current value refers to counts, an attester_<id> entry made for a
+	// value that changed since no longer does
+	attester := strings.TrimPrefix(attestation, ATTEST)
+	if attestation == "" || attester == attestation || source != attester {
+		verdict.Reason = "not attested"
+		return verdict, nil
+	}
+	if len(attesters) > 0 {
+		allowed := false
+		for _, candidate := range attesters {
+			allowed = allowed || candidate == attester
+		}
+		if !allowed {
+			verdict.Reason = "not attested"
+			return verdict, nil
+		}
+	}
+	attestations, err := getAttestClaim(APIstub, attestation)
+	if err != nil {
+		return verdict, err
+	}
+	if _, exist := attestations.Claim[user][claim]; !exist {
+		verdict.Reason = "not attested"
+		return verdict, nil
+	}
+	if root != "" {
+		chain, err := verifyTrustChain(APIstub, attester, user, claim, root)
+		if err != nil {
+			return verdict, err
+		}
+		if !chain.Trusted {
+			verdict.Reason = chain.Reason
+			return verdict, nil
+		}
+	}
+	verdict.Verified = true
+	verdict.Attester = attester
+	return verdict, nil
+}
+
+/*
+ * claimAttestation returns the source and the attestation reference of a claim of id, or of the
+ * element <claim>#<elementId> of an array claim
+ */
+func claimAttestation(id ID, name string) (string, string, bool) {
+	name, elementID := splitElement(name)
+	claim, exist := id.Claims[name]
+	if !exist || elementID == "" {
+		return claim.Source, claim.Attestation, exist
+	}
+	for _, element := range claim.Elements {
+		if element.ID == elementID {
+			return element.Source, element.Attestation, true
+		}
+	}
+	return "", "", false
+}
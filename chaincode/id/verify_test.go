@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func queryVerdict(t *testing.T, stub *testStub, args ...string) Verdict {
+	t.Helper()
+	verdict := Verdict{}
+	if err := json.Unmarshal(stub.mustInvoke("isClaimVerified", args...), &verdict); err != nil {
+		t.Fatal(err)
+	}
+	return verdict
+}
+
+func TestClaimVerifiedByNamedAttesters(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.mustInvoke("requestAttestation", "acme", "alice", "fullname", "url")
+	stub.mustInvoke("createAttestation", "acme", "alice", "fullname", "hash")
+
+	if message := stub.mustFail("isClaimVerified", "alice", "fullname", ""); message != "The attesters or the trust root to verify the claim with are required" {
+		t.Errorf("a claim was verified against any attester: %s", message)
+	}
+	if verdict := queryVerdict(t, stub, "alice", "fullname", "other,acme"); !verdict.Verified || verdict.Attester != "acme" {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+	if verdict := queryVerdict(t, stub, "alice", "fullname", "other"); verdict.Verified || verdict.Reason != "not attested" {
+		t.Errorf("the attestation of acme was accepted for other: %+v", verdict)
+	}
+	if verdict := queryVerdict(t, stub, "alice", "docid", "acme"); verdict.Verified {
+		t.Errorf("an unattested claim was verified: %+v", verdict)
+	}
+	if verdict := queryVerdict(t, stub, "nobody", "fullname", "acme"); verdict.Reason != "unknown user" {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+}
+
+func TestClaimVerifiedUnderTrustRoot(t *testing.T) {
+	stub := newAttesterStub(t)
+	stub.as(TEST_ORG, GOVERNANCE)
+	stub.mustInvoke("registerParty", "rogue", TEST_ORG)
+	stub.mustInvoke("registerTrustRoot", "GOVERNMENT", "Government")
+	stub.mustInvoke("accreditAttester", "GOVERNMENT", "acme", "fullname", "0", "0")
+	stub.as(TEST_ORG, "")
+	stub.createID("bob", "P2")
+	for user, attester := range map[string]string{"alice": "acme", "bob": "rogue"} {
+		stub.mustInvoke("requestAttestation", attester, user, "fullname", "url")
+		stub.mustInvoke("createAttestation", attester, user, "fullname", "hash")
+	}
+
+	if verdict := queryVerdict(t, stub, "alice", "fullname", "", "GOVERNMENT"); !verdict.Verified {
+		t.Errorf("unexpected verdict %+v", verdict)
+	}
+	if verdict := queryVerdict(t, stub, "bob", "fullname", "", "GOVERNMENT"); verdict.Verified || verdict.Reason != "attester was not accredited" {
+		t.Errorf("an unaccredited attester was trusted: %+v", verdict)
+	}
+	if verdict := queryVerdict(t, stub, "alice", "fullname", "", "OTHER"); verdict.Verified {
+		t.Errorf("the claim was verified under another root: %+v", verdict)
+	}
+}
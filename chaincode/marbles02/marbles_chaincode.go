@@ -90,6 +90,11 @@ import (
 type SimpleChaincode struct {
 }
 
+// New owners must have a claim verified on the identity chaincode, by an attester accredited under ownerTrustRoot
+const identityChaincode = "id"
+const ownerClaim = "fullname"
+const ownerTrustRoot = "GOVERNMENT"
+
 type marble struct {
 	ObjectType string `json:"docType"` //docType is used to distinguish the various types of objects in state database
 	Name       string `json:"name"`    //the fieldtags are needed to keep case from bouncing around
@@ -311,28 +316,64 @@ func (t *SimpleChaincode) transferMarble(stub shim.ChaincodeStubInterface, args
 	newOwner := strings.ToLower(args[1])
 	fmt.Println("- start transferMarble ", marbleName, newOwner)
 
+	// ==== Check that the new owner has a verified identity, its key is case sensitive ====
+	err := verifyOwner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	err = setMarbleOwner(stub, marbleName, newOwner)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end transferMarble (success)")
+	return shim.Success(nil)
+}
+
+// ===========================================================================================
+// setMarbleOwner rewrites a marble with a new owner, callers verify the owner first
+// ===========================================================================================
+func setMarbleOwner(stub shim.ChaincodeStubInterface, marbleName string, newOwner string) error {
 	marbleAsBytes, err := stub.GetState(marbleName)
 	if err != nil {
-		return shim.Error("Failed to get marble:" + err.Error())
+		return fmt.Errorf("Failed to get marble:%s", err.Error())
 	} else if marbleAsBytes == nil {
-		return shim.Error("Marble does not exist")
+		return fmt.Errorf("Marble does not exist")
 	}
 
 	marbleToTransfer := marble{}
 	err = json.Unmarshal(marbleAsBytes, &marbleToTransfer) //unmarshal it aka JSON.parse()
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
 	}
 	marbleToTransfer.Owner = newOwner //change the owner
 
 	marbleJSONasBytes, _ := json.Marshal(marbleToTransfer)
-	err = stub.PutState(marbleName, marbleJSONasBytes) //rewrite the marble
+	return stub.PutState(marbleName, marbleJSONasBytes) //rewrite the marble
+}
+
+// ===========================================================================================
+// verifyOwner asks the identity chaincode whether owner, an identity key, has a verified ownerClaim
+// ===========================================================================================
+func verifyOwner(stub shim.ChaincodeStubInterface, owner string) error {
+	args := [][]byte{[]byte("isClaimVerified"), []byte(owner), []byte(ownerClaim), []byte(""), []byte(ownerTrustRoot)}
+	response := stub.InvokeChaincode(identityChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("Failed to verify the identity of %s: %s", owner, response.Message)
+	}
+	verdict := struct {
+		Verified bool   `json:"verified"`
+		Reason   string `json:"reason"`
+	}{}
+	err := json.Unmarshal(response.Payload, &verdict)
 	if err != nil {
-		return shim.Error(err.Error())
+		return err
 	}
-
-	fmt.Println("- end transferMarble (success)")
-	return shim.Success(nil)
+	if !verdict.Verified {
+		return fmt.Errorf("%s has no verified identity: %s", owner, verdict.Reason)
+	}
+	return nil
 }
 
 // ===========================================================================================
@@ -413,6 +454,12 @@ func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInt
 	newOwner := strings.ToLower(args[1])
 	fmt.Println("- start transferMarblesBasedOnColor ", color, newOwner)
 
+	// ==== Check once that the new owner has a verified identity, its key is case sensitive ====
+	err := verifyOwner(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Query the color~name index by color
 	// This will execute a key range query on all keys starting with 'color'
 	coloredMarbleResultsIterator, err := stub.GetStateByPartialCompositeKey("color~name", []string{color})
@@ -439,12 +486,12 @@ func (t *SimpleChaincode) transferMarblesBasedOnColor(stub shim.ChaincodeStubInt
 		returnedMarbleName := compositeKeyParts[1]
 		fmt.Printf("- found a marble from index:%s color:%s name:%s\n", objectType, returnedColor, returnedMarbleName)
 
-		// Now call the transfer function for the found marble.
+		// Now set the verified owner on the found marble.
 		// Re-use the same function that is used to transfer individual marbles
-		response := t.transferMarble(stub, []string{returnedMarbleName, newOwner})
+		err = setMarbleOwner(stub, returnedMarbleName, newOwner)
 		// if the transfer failed break out of loop and return error
-		if response.Status != shim.OK {
-			return shim.Error("Transfer failed: " + response.Message)
+		if err != nil {
+			return shim.Error("Transfer failed: " + err.Error())
 		}
 	}
 
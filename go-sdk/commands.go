@@ -0,0 +1,275 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hendry19901990/fabric-identity/go-sdk/identity"
+)
+
+// session is what a command runs with: the client and the transient values of the connection flags
+type session struct {
+	ids    *identity.Client
+	opts   []identity.Option
+	secret []byte
+}
+
+// runner runs a command with its positional args and returns the result to print, nil for none
+type runner func(s *session, args []string) (interface{}, error)
+
+type command struct {
+	path string
+	// args is the usage of the positional args, optional ones in brackets
+	args  string
+	help  string
+	setup func(flags *flag.FlagSet) runner
+}
+
+// plain is the setup of commands without flags
+func plain(run runner) func(flags *flag.FlagSet) runner {
+	return func(flags *flag.FlagSet) runner { return run }
+}
+
+var commands = []command{
+	{path: "id create", args: "<fullname> <docid>", help: "create an identity owned by -secret, the key is generated unless -id is given", setup: func(flags *flag.FlagSet) runner {
+		id := flags.String("id", "", "key of the identity")
+		return func(s *session, args []string) (interface{}, error) {
+			user, err := s.ids.CreateID(*id, args[0], args[1], s.opts...)
+			return map[string]string{"user": user}, err
+		}
+	}},
+	{path: "id remove", args: "<user>", help: "remove an identity", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.RemoveUser(args[0])
+	})},
+	{path: "id claim add", args: "<user> <claim> <value>", help: "set a claim of an identity", setup: func(flags *flag.FlagSet) runner {
+		typ := flags.String("type", identity.ClaimString, "type of the value: string, number, date, boolean, object or array")
+		return func(s *session, args []string) (interface{}, error) {
+			return nil, s.ids.AddClaim(args[0], args[1], args[2], *typ, s.opts...)
+		}
+	}},
+	{path: "id claim element add", args: "<user> <claim> <value>", help: "append an element to an array claim", setup: func(flags *flag.FlagSet) runner {
+		typ := flags.String("type", identity.ClaimString, "type of the element: string, number, date, boolean or object")
+		return func(s *session, args []string) (interface{}, error) {
+			element, err := s.ids.AddClaimElement(args[0], args[1], args[2], *typ, s.opts...)
+			return map[string]string{"element": element, "claim": identity.ElementClaim(args[1], element)}, err
+		}
+	}},
+	{path: "id claim element remove", args: "<user> <claim> <elementId>", help: "remove an element from an array claim", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.RemoveClaimElement(args[0], args[1], args[2], s.opts...)
+	})},
+	{path: "id link", args: "<user> <other>", help: "consent to link an identity with another one (-secret of user)", setup: plain(func(s *session, args []string) (interface{}, error) {
+		if s.secret == nil {
+			return nil, fmt.Errorf("-secret is required")
+		}
+		linked, err := s.ids.LinkIdentities(args[0], args[1], s.secret)
+		return map[string]bool{"linked": linked}, err
+	})},
+	{path: "id merge", args: "<survivor> <merged>", help: "merge a linked identity into the survivor (-secret of merged)", setup: plain(func(s *session, args []string) (interface{}, error) {
+		if s.secret == nil {
+			return nil, fmt.Errorf("-secret is required")
+		}
+		return nil, s.ids.MergeIdentities(args[0], args[1], s.secret, s.opts...)
+	})},
+	{path: "id secret", args: "<user>", help: "bind an identity without owner secret to -secret (governance admins only)", setup: plain(func(s *session, args []string) (interface{}, error) {
+		if s.secret == nil {
+			return nil, fmt.Errorf("-secret is required")
+		}
+		return nil, s.ids.SetOwnerSecret(args[0], identity.OwnerSecretHash(args[0], s.secret))
+	})},
+
+	{path: "attest request", args: "<attester> <user> <claim> <claimUrl>", help: "ask an attester to attest a claim", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.RequestAttestation(args[0], args[1], args[2], args[3])
+	})},
+	{path: "attest issue", args: "<attester> <user> <claim> <hashClaim>", help: "attest a requested claim", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.CreateAttestation(args[0], args[1], args[2], args[3])
+	})},
+	{path: "attest reject", args: "<attester> <user> <claim>", help: "reject a requested claim", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.RejectAttestation(args[0], args[1], args[2])
+	})},
+	{path: "attest revoke", args: "<attester> <user> <claim>", help: "revoke an attestation", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return nil, s.ids.RevokeAttestation(args[0], args[1], args[2])
+	})},
+
+	{path: "share grant", args: "<user> <relyingParty> <claim>", help: "share a claim with a relying party, prints the token to hand over", setup: func(flags *flag.FlagSet) runner {
+		share := identity.Share{}
+		flags.IntVar(&share.ValidDays, "days", 0, "validity of the share in days, 0 for the default of the claim schema")
+		flags.StringVar(&share.Purpose, "purpose", "", "purpose of the share, recorded in the consent receipt")
+		flags.StringVar(&share.Jurisdiction, "jurisdiction", "", "jurisdiction of the consent receipt")
+		flags.BoolVar(&share.SingleUse, "single-use", false, "the token can only be used once")
+		return func(s *session, args []string) (interface{}, error) {
+			return s.ids.ShareInfo(args[0], args[1], args[2], share, s.opts...)
+		}
+	}},
+	{path: "share redeem", args: "<user> <relyingParty> <claim> <token>", help: "redeem a share token as the relying party", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.RedeemShareToken(args[0], args[1], args[2], args[3])
+	})},
+	{path: "share access", args: "<user> <relyingParty> <token>", help: "read the claims shared with a relying party", setup: func(flags *flag.FlagSet) runner {
+		claims := flags.String("claims", "", "claims to read, comma separated, all shared claims when empty")
+		return func(s *session, args []string) (interface{}, error) {
+			shared, err := s.ids.AccessSharedClaims(args[0], args[1], args[2], splitList(*claims))
+			if err != nil {
+				return nil, err
+			}
+			return shared.Claims, nil
+		}
+	}},
+
+	{path: "query user", args: "<user>", help: "the identity record of a user", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.GetUser(args[0])
+	})},
+	{path: "query claims", args: "<user>", help: "the claims of a user, decrypted with -claim-key", setup: plain(func(s *session, args []string) (interface{}, error) {
+		claims, err := s.ids.QueryClaims(args[0], s.opts...)
+		if err != nil {
+			return nil, err
+		}
+		return claimsView(*claims), nil
+	})},
+	{path: "query requests", args: "<attester>", help: "the pending attestation requests of an attester", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryRequestAttestation(args[0])
+	})},
+	{path: "query attestations", args: "<attester>", help: "the attestations of an attester", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryAttestation(args[0])
+	})},
+	{path: "query verified", args: "<user> <claim> [attesters]", help: "whether a claim is attested by one of the comma separated attesters or under -root", setup: func(flags *flag.FlagSet) runner {
+		root := flags.String("root", "", "trust root the attester must be accredited under")
+		return func(s *session, args []string) (interface{}, error) {
+			return s.ids.IsClaimVerified(args[0], args[1], splitList(optionalArg(args, 2)), *root)
+		}
+	}},
+	{path: "query trust", args: "<attester> <user> <claim> <root>", help: "whether an attestation chains up to a trust root", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.TrustChain(args[0], args[1], args[2], args[3])
+	})},
+	{path: "query accreditations", args: "<attester>", help: "the accreditations of an attester", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryAccreditations(args[0])
+	})},
+	{path: "query party", args: "<party>", help: "the org of an attester or a relying party", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryParty(args[0])
+	})},
+	{path: "query stats", args: "<attester>", help: "the statistics of an attester", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryAttesterStats(args[0])
+	})},
+	{path: "query leaderboard", args: "<metric> [limit]", help: "attesters ranked by requests, attested, rejected, revoked or medianTurnaround", setup: plain(func(s *session, args []string) (interface{}, error) {
+		limit := 0
+		if len(args) > 1 {
+			var err error
+			if limit, err = strconv.Atoi(args[1]); err != nil {
+				return nil, fmt.Errorf("limit must be a number")
+			}
+		}
+		return s.ids.AttesterLeaderboard(args[0], limit)
+	})},
+	{path: "query access-log", args: "<user> [relyingParty]", help: "who read the shared claims of a user, pseudonymous reads with -secret", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryAccessLog(args[0], optionalArg(args, 1), s.opts...)
+	})},
+	{path: "query consents", args: "<user>", help: "the pending consent requests of a user", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryConsentRequests(args[0])
+	})},
+	{path: "query receipts", args: "<user>", help: "the consent receipts of a user, pseudonymous ones with -secret", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryReceiptsByUser(args[0], s.opts...)
+	})},
+	{path: "query receipt", args: "<receiptId>", help: "a consent receipt", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryConsentReceipt(args[0])
+	})},
+	{path: "query conflicts", args: "[user]", help: "the document number conflicts, of a claimant or all of them", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryDocConflicts(optionalArg(args, 0))
+	})},
+	{path: "query schemas", help: "the registered claim types", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryClaimSchemas()
+	})},
+	{path: "query schema", args: "<claim>", help: "the schema of a claim type", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryClaimSchema(args[0])
+	})},
+	{path: "query deposit", help: "the requester id and deposit balance of the user", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryDeposit()
+	})},
+	{path: "query invoice", args: "<party> <period>", help: "the invoice of a party for a period (YYYY-MM)", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryInvoice(args[0], args[1])
+	})},
+	{path: "query invoices", args: "<party>", help: "the invoices of the closed periods of a party", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.QueryInvoices(args[0])
+	})},
+	{path: "query functions", help: "the functions of the chaincode and their args", setup: plain(func(s *session, args []string) (interface{}, error) {
+		return s.ids.Describe()
+	})},
+}
+
+// findCommand returns the command with the longest path argv starts with, and the rest of argv
+func findCommand(argv []string) (*command, []string) {
+	var found *command
+	rest := argv
+	for i := range commands {
+		path := strings.Fields(commands[i].path)
+		if len(path) > len(argv) || (found != nil && len(path) <= len(strings.Fields(found.path))) {
+			continue
+		}
+		if strings.Join(argv[:len(path)], " ") == commands[i].path {
+			found, rest = &commands[i], argv[len(path):]
+		}
+	}
+	return found, rest
+}
+
+// check checks the number of positional args against the usage of the command
+func (cmd command) check(args []string) error {
+	required, total := 0, 0
+	for _, arg := range strings.Fields(cmd.args) {
+		total++
+		if !strings.HasPrefix(arg, "[") {
+			required++
+		}
+	}
+	if len(args) < required || len(args) > total {
+		return fmt.Errorf("%s expects %s", cmd.path, cmd.args)
+	}
+	return nil
+}
+
+// claimsView prints the claims of a user one per row
+type claimsView identity.Claims
+
+func (view claimsView) table() ([]string, [][]string) {
+	names := make([]string, 0, len(view.Claims))
+	for name := range view.Claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := [][]string{}
+	for _, name := range names {
+		claim := view.Claims[name]
+		typ := claim.Type
+		if typ == "" {
+			typ = identity.ClaimString
+		}
+		rows = append(rows, []string{name, claim.Value, typ, claim.Source, strconv.FormatInt(claim.Updated, 10)})
+		for _, element := range claim.Elements {
+			typ := element.Type
+			if typ == "" {
+				typ = identity.ClaimString
+			}
+			rows = append(rows, []string{identity.ElementClaim(name, element.ID), element.Value, typ, element.Source, strconv.FormatInt(element.Added, 10)})
+		}
+	}
+	return []string{"CLAIM", "VALUE", "TYPE", "SOURCE", "UPDATED"}, rows
+}
+
+// splitList parses a comma separated argument, ignoring empty entries
+func splitList(arg string) []string {
+	list := []string{}
+	for _, item := range strings.Split(arg, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+package identity
+
+import "bytes"
+
+// RequestAttestation asks attester to attest a claim of the user, claimURL points to the evidence.
+// The client must belong to the org whose peers endorse the ID of the user.
+// Beyond the quota of the attester the request locks a deposit of the caller.
+func (c *Client) RequestAttestation(attester, userID, claim, claimURL string) error {
+	_, err := c.execute("requestAttestation", []string{attester, userID, claim, claimURL}, nil, nil)
+	return err
+}
+
+// CreateAttestation attests a requested claim of the user, hashClaim is the hash of the attested value.
+// The client must belong to the org the attester is registered with, as for RejectAttestation and
+// RevokeAttestation.
+func (c *Client) CreateAttestation(attester, userID, claim, hashClaim string) error {
+	_, err := c.execute("createAttestation", []string{attester, userID, claim, hashClaim}, nil, nil)
+	return err
+}
+
+// RejectAttestation rejects a requested claim, a locked deposit is forfeited
+func (c *Client) RejectAttestation(attester, userID, claim string) error {
+	_, err := c.execute("rejectAttestation", []string{attester, userID, claim}, nil, nil)
+	return err
+}
+
+// RevokeAttestation withdraws an attestation
+func (c *Client) RevokeAttestation(attester, userID, claim string) error {
+	_, err := c.execute("revokeAttestation", []string{attester, userID, claim}, nil, nil)
+	return err
+}
+
+// QueryRequestAttestation returns the pending attestation requests of an attester
+func (c *Client) QueryRequestAttestation(attester string) ([]UserClaims, error) {
+	return c.queryUserClaims("queryRequestAttestation", attester)
+}
+
+// QueryAttestation returns the attestations of an attester
+func (c *Client) QueryAttestation(attester string) ([]UserClaims, error) {
+	return c.queryUserClaims("queryAttestation", attester)
+}
+
+func (c *Client) queryUserClaims(fcn string, attester string) ([]UserClaims, error) {
+	payload, err := c.query(fcn, []string{attester}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	users := []UserClaims{}
+	// an attester without requests or attestations gets an error object instead of an array
+	if bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		return users, nil
+	}
+	err = decode(fcn, payload, &users)
+	return users, err
+}
+
+// IsClaimVerified reports whether the current value of a claim of the user is attested by one of
+// the attesters, or by an attester accredited under root. At least one of them must be given.
+func (c *Client) IsClaimVerified(userID, claim string, attesters []string, root string) (*Verdict, error) {
+	verdict := &Verdict{}
+	if err := c.queryJSON(verdict, "isClaimVerified", []string{userID, claim, list(attesters), root}, nil, nil); err != nil {
+		return nil, err
+	}
+	return verdict, nil
+}
+
+// QueryAttesterStats returns the counters and the median turnaround of an attester
+func (c *Client) QueryAttesterStats(attester string) (*AttesterStats, error) {
+	stats := &AttesterStats{}
+	if err := c.queryJSON(stats, "queryAttesterStats", []string{attester}, nil, nil); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// AttesterLeaderboard ranks the attesters by one of the Metric constants, limit 0 returns all of them
+func (c *Client) AttesterLeaderboard(metric string, limit int) ([]AttesterStats, error) {
+	board := []AttesterStats{}
+	err := c.queryJSON(&board, "attesterLeaderboard", []string{metric, itoa(limit)}, nil, nil)
+	return board, err
+}
+
+// PruneAttesterStats folds the counter rows of an attester (governance admins only)
+func (c *Client) PruneAttesterStats(attester string) error {
+	_, err := c.execute("pruneAttesterStats", []string{attester}, nil, nil)
+	return err
+}
+
+// RegisterTrustRoot registers an attester as a root of accreditations (governance admins only)
+func (c *Client) RegisterTrustRoot(root, name string) error {
+	_, err := c.execute("registerTrustRoot", []string{root, name}, nil, nil)
+	return err
+}
+
+// AccreditAttester allows a registered attester to attest the claims, maxDepth levels of
+// sub-accreditation below it, for validDays days (0 for no expiry). An existing accreditation has
+// to be revoked first.
+func (c *Client) AccreditAttester(accreditor, attester string, claims []string, maxDepth, validDays int) error {
+	_, err := c.execute("accreditAttester", []string{accreditor, attester, list(claims), itoa(maxDepth), itoa(validDays)}, nil, nil)
+	return err
+}
+
+// RevokeAccreditation revokes the accreditation of an attester for a claim (governance admins only)
+func (c *Client) RevokeAccreditation(attester, claim string) error {
+	_, err := c.execute("revokeAccreditation", []string{attester, claim}, nil, nil)
+	return err
+}
+
+// QueryAccreditations returns the accreditations of an attester
+func (c *Client) QueryAccreditations(attester string) ([]Accreditation, error) {
+	accreditations := []Accreditation{}
+	err := c.queryJSON(&accreditations, "queryAccreditations", []string{attester}, nil, nil)
+	return accreditations, err
+}
+
+// TrustChain checks that an attestation of attester chains up to root through live accreditations
+func (c *Client) TrustChain(attester, userID, claim, root string) (*TrustVerdict, error) {
+	verdict := &TrustVerdict{}
+	if err := c.queryJSON(verdict, "trustChain", []string{attester, userID, claim, root}, nil, nil); err != nil {
+		return nil, err
+	}
+	return verdict, nil
+}
+
+// SetRateLimit sets the rate limit of an attester, "*" for the default of all attesters (governance admins only)
+func (c *Client) SetRateLimit(attester string, limit RateLimit) error {
+	args := []string{attester, itoa(limit.MaxRequests), formatInt(limit.Window), formatInt(limit.Cooldown), formatInt(limit.Deposit)}
+	_, err := c.execute("setRateLimit", args, nil, nil)
+	return err
+}
+
+// QueryRateLimit returns the rate limit that applies to an attester
+func (c *Client) QueryRateLimit(attester string) (*RateLimit, error) {
+	limit := &RateLimit{}
+	if err := c.queryJSON(limit, "queryRateLimit", []string{attester}, nil, nil); err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+// CreditDeposit credits the deposit balance of a requester (governance admins only)
+func (c *Client) CreditDeposit(requester string, amount int64) error {
+	_, err := c.execute("creditDeposit", []string{requester, formatInt(amount)}, nil, nil)
+	return err
+}
+
+// QueryDeposit returns the requester id and the deposit balance of the caller
+func (c *Client) QueryDeposit() (*Deposit, error) {
+	deposit := &Deposit{}
+	if err := c.queryJSON(deposit, "queryDeposit", nil, nil, nil); err != nil {
+		return nil, err
+	}
+	return deposit, nil
+}
@@ -0,0 +1,165 @@
+// Package identity is a client of the identity chaincode (chaincode/id) built on the channel
+// client of fabric-sdk-go. Every chaincode function is a typed method: arguments are marshalled
+// in the order the chaincode expects, sensitive values travel in the transient map so they are
+// not recorded in the blocks, and JSON results are decoded into the structs of types.go.
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+)
+
+// DefaultChaincodeID is the name the identity chaincode is installed with
+const DefaultChaincodeID = "id"
+
+// Transient map keys the identity chaincode reads
+const (
+	transientFullname = "fullname"
+	transientDocID    = "docid"
+	transientValue    = "value"
+	transientToken    = "token"
+	transientSecret   = "secret"
+	transientClaimKey = "claimKey"
+	transientRecords  = "records"
+	transientDocIndex = "docIndexKey"
+)
+
+// Client calls the identity chaincode through a channel client
+type Client struct {
+	channel     *channel.Client
+	chaincodeID string
+	targets     []string
+}
+
+// New returns a client of the identity chaincode installed as chaincodeID, DefaultChaincodeID when empty
+func New(client *channel.Client, chaincodeID string) *Client {
+	if chaincodeID == "" {
+		chaincodeID = DefaultChaincodeID
+	}
+	return &Client{channel: client, chaincodeID: chaincodeID}
+}
+
+// WithTargets returns a copy of the client that sends its queries to the given peers
+func (c *Client) WithTargets(endpoints ...string) *Client {
+	clone := *c
+	clone.targets = endpoints
+	return &clone
+}
+
+// Option adds a value to the transient map of a call
+type Option func(transient map[string][]byte)
+
+// WithSecret sends the owner secret of the user, bound by CreateID and needed to share under a
+// pairwise pseudonym and to prove the ownership of an identity
+func WithSecret(secret []byte) Option {
+	return func(transient map[string][]byte) {
+		transient[transientSecret] = secret
+	}
+}
+
+// WithClaimKey sends the 32 bytes AES-256 key claim values are encrypted and decrypted with
+func WithClaimKey(key []byte) Option {
+	return func(transient map[string][]byte) {
+		transient[transientClaimKey] = key
+	}
+}
+
+// ChaincodeError is the error message returned by the chaincode, or by the peers endorsing it
+type ChaincodeError struct {
+	Function string
+	Err      error
+}
+
+func (e *ChaincodeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Function, e.Err.Error())
+}
+
+// query evaluates a function on the peers without submitting it to the orderer
+func (c *Client) query(fcn string, args []string, transient map[string][]byte, opts []Option) ([]byte, error) {
+	options := []channel.RequestOption{channel.WithRetry(retry.DefaultChannelOpts)}
+	if len(c.targets) > 0 {
+		options = append(options, channel.WithTargetEndpoints(c.targets...))
+	}
+	response, err := c.channel.Query(c.request(fcn, args, transient, opts), options...)
+	if err != nil {
+		return nil, &ChaincodeError{Function: fcn, Err: err}
+	}
+	return response.Payload, nil
+}
+
+// execute submits a transaction and waits for it to be committed
+func (c *Client) execute(fcn string, args []string, transient map[string][]byte, opts []Option) ([]byte, error) {
+	response, err := c.channel.Execute(c.request(fcn, args, transient, opts), channel.WithRetry(retry.DefaultChannelOpts))
+	if err != nil {
+		return nil, &ChaincodeError{Function: fcn, Err: err}
+	}
+	return response.Payload, nil
+}
+
+func (c *Client) request(fcn string, args []string, transient map[string][]byte, opts []Option) channel.Request {
+	if transient == nil {
+		transient = make(map[string][]byte)
+	}
+	for _, opt := range opts {
+		opt(transient)
+	}
+	request := channel.Request{ChaincodeID: c.chaincodeID, Fcn: fcn, Args: make([][]byte, len(args))}
+	for i, arg := range args {
+		request.Args[i] = []byte(arg)
+	}
+	if len(transient) > 0 {
+		request.TransientMap = transient
+	}
+	return request
+}
+
+// queryJSON evaluates a function and decodes its JSON result into v
+func (c *Client) queryJSON(v interface{}, fcn string, args []string, transient map[string][]byte, opts []Option) error {
+	payload, err := c.query(fcn, args, transient, opts)
+	if err != nil {
+		return err
+	}
+	return decode(fcn, payload, v)
+}
+
+// executeJSON submits a transaction and decodes its JSON result into v
+func (c *Client) executeJSON(v interface{}, fcn string, args []string, transient map[string][]byte, opts []Option) error {
+	payload, err := c.execute(fcn, args, transient, opts)
+	if err != nil {
+		return err
+	}
+	return decode(fcn, payload, v)
+}
+
+func decode(fcn string, payload []byte, v interface{}) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%s returned an unexpected result: %s", fcn, err.Error())
+	}
+	return nil
+}
+
+// list is the comma separated form of list arguments
+func list(values []string) string {
+	return strings.Join(values, ",")
+}
+
+func itoa(i int) string {
+	return strconv.Itoa(i)
+}
+
+// days is a validDays argument, empty for zero so the chaincode applies the claim schema default
+func days(validDays int) string {
+	if validDays == 0 {
+		return ""
+	}
+	return itoa(validDays)
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
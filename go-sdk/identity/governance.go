@@ -0,0 +1,168 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// SetBillingRate sets the unit price of a usage kind, access or attestation (governance admins only)
+func (c *Client) SetBillingRate(kind string, unitPrice int64) error {
+	_, err := c.execute("setBillingRate", []string{kind, formatInt(unitPrice)}, nil, nil)
+	return err
+}
+
+// CloseBillingPeriod writes the invoices of a past period, YYYY-MM (governance admins only)
+func (c *Client) CloseBillingPeriod(period string) (*PeriodSummary, error) {
+	summary := &PeriodSummary{}
+	if err := c.executeJSON(summary, "closeBillingPeriod", []string{period}, nil, nil); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// QueryInvoice returns the invoice of a party for a period, computed from the usage while the period is open
+func (c *Client) QueryInvoice(party, period string) (*Invoice, error) {
+	invoice := &Invoice{}
+	if err := c.queryJSON(invoice, "queryInvoice", []string{party, period}, nil, nil); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// QueryInvoices returns the invoices of the closed periods of a party
+func (c *Client) QueryInvoices(party string) ([]Invoice, error) {
+	invoices := []Invoice{}
+	err := c.queryJSON(&invoices, "queryInvoices", []string{party}, nil, nil)
+	return invoices, err
+}
+
+// DisputeInvoice disputes the invoice of a party for a period, the client must be of the org of the party
+func (c *Client) DisputeInvoice(party, period, reason string) error {
+	_, err := c.execute("disputeInvoice", []string{party, period, reason}, nil, nil)
+	return err
+}
+
+// ResolveInvoiceDispute settles the dispute of an invoice (governance admins only)
+func (c *Client) ResolveInvoiceDispute(party, period, resolution string) error {
+	_, err := c.execute("resolveInvoiceDispute", []string{party, period, resolution}, nil, nil)
+	return err
+}
+
+// RegisterParty registers the org of an attester or a relying party (governance admins only).
+// The consent receipts of the claims shared with a relying party name its controller, receipts of
+// relying parties registered without one only name the relying party.
+func (c *Client) RegisterParty(party, org string, controller *Controller) error {
+	args := []string{party, org}
+	if controller != nil {
+		controllerAsBytes, err := json.Marshal(controller)
+		if err != nil {
+			return err
+		}
+		args = append(args, string(controllerAsBytes))
+	}
+	_, err := c.execute("registerParty", args, nil, nil)
+	return err
+}
+
+// QueryParty returns a registered attester or relying party
+func (c *Client) QueryParty(party string) (*Party, error) {
+	registered := &Party{}
+	if err := c.queryJSON(registered, "queryParty", []string{party}, nil, nil); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// RegisterClaimSchema registers or updates a claim type (governance admins only)
+func (c *Client) RegisterClaimSchema(schema ClaimSchema) error {
+	args := []string{schema.Name, schema.Pattern, schema.JSONSchema, schema.Sensitivity, list(schema.Attesters), itoa(schema.ValidDays)}
+	_, err := c.execute("registerClaimSchema", args, nil, nil)
+	return err
+}
+
+// QueryClaimSchema returns the schema of a claim type
+func (c *Client) QueryClaimSchema(claim string) (*ClaimSchema, error) {
+	schema := &ClaimSchema{}
+	if err := c.queryJSON(schema, "queryClaimSchema", []string{claim}, nil, nil); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// QueryClaimSchemas returns the registered claim types
+func (c *Client) QueryClaimSchemas() ([]ClaimSchema, error) {
+	schemas := []ClaimSchema{}
+	err := c.queryJSON(&schemas, "queryClaimSchemas", nil, nil, nil)
+	return schemas, err
+}
+
+// OwnerSecretHash is the SecretHash of an IdentityRecord owned by whoever knows secret, the same
+// hash CreateID binds an identity to
+func OwnerSecretHash(userID string, secret []byte) string {
+	h := sha256.Sum256(append([]byte(userID+":"), secret...))
+	return hex.EncodeToString(h[:])
+}
+
+// SetOwnerSecret binds an identity created without owner secret to secretHash, see OwnerSecretHash
+// (governance admins only)
+func (c *Client) SetOwnerSecret(userID, secretHash string) error {
+	_, err := c.execute("setOwnerSecret", []string{userID, secretHash}, nil, nil)
+	return err
+}
+
+// ImportIdentities creates identities in bulk, the records are sent in the transient map (governance admins only)
+func (c *Client) ImportIdentities(records []IdentityRecord, opts ...Option) ([]ImportResult, error) {
+	recordsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	results := []ImportResult{}
+	err = c.executeJSON(&results, "importIdentities", nil, map[string][]byte{transientRecords: recordsAsBytes}, opts)
+	return results, err
+}
+
+// ExportIdentities returns a page of identities, from the start when bookmark is empty, without the
+// identities merged into another one (governance admins only)
+func (c *Client) ExportIdentities(pageSize int, bookmark string) (*ExportPage, error) {
+	args := []string{itoa(pageSize)}
+	if bookmark != "" {
+		args = append(args, bookmark)
+	}
+	page := &ExportPage{}
+	if err := c.queryJSON(page, "exportIdentities", args, nil, nil); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// MigrateBatch migrates up to batchSize records to the current record version (governance admins only)
+func (c *Client) MigrateBatch(batchSize int) (*MigrationState, error) {
+	state := &MigrationState{}
+	if err := c.executeJSON(state, "migrateBatch", []string{itoa(batchSize)}, nil, nil); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// QueryKeyPolicy returns the organizations that must endorse changes of a key (governance admins only)
+func (c *Client) QueryKeyPolicy(key string) (*KeyPolicy, error) {
+	policy := &KeyPolicy{}
+	if err := c.queryJSON(policy, "queryKeyPolicy", []string{key}, nil, nil); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// SetKeyPolicy sets the organizations that must endorse changes of a key (governance admins only)
+func (c *Client) SetKeyPolicy(key string, orgs []string) error {
+	_, err := c.execute("setKeyPolicy", []string{key, list(orgs)}, nil, nil)
+	return err
+}
+
+// Describe returns the functions of the chaincode with their arguments
+func (c *Client) Describe() ([]FunctionDescription, error) {
+	functions := []FunctionDescription{}
+	err := c.queryJSON(&functions, "describe", nil, nil, nil)
+	return functions, err
+}
@@ -0,0 +1,131 @@
+package identity
+
+// InitLedger writes the sample identities ID1 to ID9
+func (c *Client) InitLedger() error {
+	_, err := c.execute("initLedger", nil, nil, nil)
+	return err
+}
+
+// CreateID creates an identity and returns its key, the chaincode generates the key when userID
+// is empty. fullname and docID are sent in the transient map. The secret of WithSecret is bound
+// to the identity, pseudonyms, links and merges need it later on.
+func (c *Client) CreateID(userID, fullname, docID string, opts ...Option) (string, error) {
+	args := []string{}
+	if userID != "" {
+		args = append(args, userID)
+	}
+	transient := map[string][]byte{transientFullname: []byte(fullname), transientDocID: []byte(docID)}
+	payload, err := c.execute("createId", args, transient, opts)
+	return string(payload), err
+}
+
+// AddClaim sets a claim of the user to a value of type typ (ClaimString when empty), the value
+// is sent in the transient map and encrypted on the ledger when WithClaimKey is given
+func (c *Client) AddClaim(userID, claim, value, typ string, opts ...Option) error {
+	args := []string{userID, claim}
+	if typ != "" {
+		args = append(args, typ)
+	}
+	_, err := c.execute("addClaim", args, map[string][]byte{transientValue: []byte(value)}, opts)
+	return err
+}
+
+// AddClaimElement appends an element of type typ (ClaimString when empty) to an array claim and returns its id
+func (c *Client) AddClaimElement(userID, claim, value, typ string, opts ...Option) (string, error) {
+	args := []string{userID, claim}
+	if typ != "" {
+		args = append(args, typ)
+	}
+	payload, err := c.execute("addClaimElement", args, map[string][]byte{transientValue: []byte(value)}, opts)
+	return string(payload), err
+}
+
+// RemoveClaimElement removes an element from an array claim
+func (c *Client) RemoveClaimElement(userID, claim, elementID string, opts ...Option) error {
+	_, err := c.execute("removeClaimElement", []string{userID, claim, elementID}, nil, opts)
+	return err
+}
+
+// ElementClaim is the claim name to attest an element of an array claim with
+func ElementClaim(claim, elementID string) string {
+	return claim + "#" + elementID
+}
+
+// RemoveUser deletes the identity of the user
+func (c *Client) RemoveUser(userID string) error {
+	_, err := c.execute("removeUser", []string{userID}, nil, nil)
+	return err
+}
+
+// GetUser returns the identity record of the user, following merges to the surviving identity
+func (c *Client) GetUser(userID string) (*ID, error) {
+	id := &ID{}
+	if err := c.queryJSON(id, "getUserById", []string{userID}, nil, nil); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// QueryClaims returns the claims of the user, decrypted when WithClaimKey is given
+func (c *Client) QueryClaims(userID string, opts ...Option) (*Claims, error) {
+	claims := &Claims{}
+	if err := c.queryJSON(claims, "queryClaimsById", []string{userID}, nil, opts); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// LinkIdentities records the consent of the owner of userID to be linked with other, and
+// reports whether the owner of other consented too
+func (c *Client) LinkIdentities(userID, other string, secret []byte) (bool, error) {
+	payload, err := c.execute("linkIdentities", []string{userID, other}, map[string][]byte{transientSecret: secret}, nil)
+	return string(payload) == "linked", err
+}
+
+// QueryLinkedIdentities returns the identities linked with the user by both owners
+func (c *Client) QueryLinkedIdentities(userID string) ([]string, error) {
+	linked := []string{}
+	err := c.queryJSON(&linked, "queryLinkedIdentities", []string{userID}, nil, nil)
+	return linked, err
+}
+
+// MergeIdentities moves the linked identity merged into survivor, secret is the one of merged.
+// Encrypted claims are only moved with WithClaimKey.
+func (c *Client) MergeIdentities(survivor, merged string, secret []byte, opts ...Option) error {
+	_, err := c.execute("mergeIdentities", []string{survivor, merged}, map[string][]byte{transientSecret: secret}, opts)
+	return err
+}
+
+// QueryDocConflicts returns the document number conflicts of a claimant, all of them when userID is empty
+func (c *Client) QueryDocConflicts(userID string) ([]DocConflict, error) {
+	args := []string{}
+	if userID != "" {
+		args = append(args, userID)
+	}
+	conflicts := []DocConflict{}
+	err := c.queryJSON(&conflicts, "queryDocConflicts", args, nil, nil)
+	return conflicts, err
+}
+
+// ResolveDocConflict settles a conflict as attester, decision is DecisionHolder or DecisionClaimant.
+// The caller must be a governance admin or belong to the org of an attester accredited for docid.
+func (c *Client) ResolveDocConflict(claimant, conflictID, attester, decision string) error {
+	_, err := c.execute("resolveDocConflict", []string{claimant, conflictID, attester, decision}, nil, nil)
+	return err
+}
+
+// SetDocIndexKey sets the 32 bytes secret key the document numbers are indexed with, once
+// (governance admins only). It is sent in the transient map.
+func (c *Client) SetDocIndexKey(key []byte) error {
+	_, err := c.execute("setDocIndexKey", nil, map[string][]byte{transientDocIndex: key}, nil)
+	return err
+}
+
+// IndexDocIDs indexes the document numbers of up to limit identities from startKey (governance admins only)
+func (c *Client) IndexDocIDs(startKey string, limit int, opts ...Option) (*IndexResult, error) {
+	result := &IndexResult{}
+	if err := c.executeJSON(result, "indexDocIDs", []string{startKey, itoa(limit)}, nil, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
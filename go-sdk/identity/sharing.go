@@ -0,0 +1,139 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+)
+
+// NewShareToken generates the token a user hands to a relying party.
+// Tokens are created here, off-chain, the identity chaincode only stores their salted hash.
+func NewShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ShareInfo shares a claim of the user with a relying party under a new token and returns the
+// token with the consent receipt. With WithSecret the relying party only learns its pairwise
+// pseudonym of the user.
+func (c *Client) ShareInfo(userID, relyingParty, claim string, share Share, opts ...Option) (*Grant, error) {
+	token, err := NewShareToken()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{userID, relyingParty, claim, days(share.ValidDays), share.Purpose, share.Jurisdiction, strconv.FormatBool(share.SingleUse)}
+	payload, err := c.execute("shareinfo", args, map[string][]byte{transientToken: []byte(token)}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Grant{Token: token, ReceiptID: string(payload)}, nil
+}
+
+// RedeemShareToken checks the token of a share as the relying party, the client must belong to the
+// org the relying party is registered with. Single use tokens are used up by AccessSharedClaims.
+func (c *Client) RedeemShareToken(userID, relyingParty, claim, token string) (*Redemption, error) {
+	redemption := &Redemption{}
+	if err := c.executeJSON(redemption, "redeemShareToken", []string{userID, relyingParty, claim}, map[string][]byte{transientToken: []byte(token)}, nil); err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// AccessSharedClaims reads the claims shared with the relying party, all shared claims when
+// claims is empty, and records the access with the client that made it. The client must belong
+// to the org the relying party is registered with, userID may be the pseudonym of the relying party.
+func (c *Client) AccessSharedClaims(userID, relyingParty, token string, claims []string) (*SharedClaims, error) {
+	args := []string{userID, relyingParty}
+	if len(claims) > 0 {
+		args = append(args, list(claims))
+	}
+	shared := &SharedClaims{}
+	if err := c.executeJSON(shared, "accessSharedClaim", args, map[string][]byte{transientToken: []byte(token)}, nil); err != nil {
+		return nil, err
+	}
+	return shared, nil
+}
+
+// QueryAccessLog returns who read the shared claims of the user, only relyingParty when not empty.
+// Reads made with a pairwise pseudonym are only listed with WithSecret.
+func (c *Client) QueryAccessLog(userID, relyingParty string, opts ...Option) ([]AccessLogEntry, error) {
+	args := []string{userID}
+	if relyingParty != "" {
+		args = append(args, relyingParty)
+	}
+	entries := []AccessLogEntry{}
+	err := c.queryJSON(&entries, "queryAccessLog", args, nil, opts)
+	return entries, err
+}
+
+// ResolvePseudonym returns the user key behind the pairwise pseudonym of a relying party
+func (c *Client) ResolvePseudonym(pseudonym, relyingParty string) (string, error) {
+	payload, err := c.query("resolvePseudonym", []string{pseudonym, relyingParty}, nil, nil)
+	return string(payload), err
+}
+
+// RequestConsent asks the user to share claims with the relying party and returns the request id,
+// a zero validDays takes the shortest default of the claim schemas. The client must belong to the
+// org the relying party is registered with, userID may be the pseudonym of the relying party.
+func (c *Client) RequestConsent(userID, relyingParty string, claims []string, purpose string, validDays int, jurisdiction string) (string, error) {
+	args := []string{userID, relyingParty, list(claims), purpose, days(validDays)}
+	if jurisdiction != "" {
+		args = append(args, jurisdiction)
+	}
+	payload, err := c.execute("requestConsent", args, nil, nil)
+	return string(payload), err
+}
+
+// QueryConsentRequests returns the pending consent requests of the user
+func (c *Client) QueryConsentRequests(userID string) ([]ConsentRequest, error) {
+	requests := []ConsentRequest{}
+	err := c.queryJSON(&requests, "queryConsentRequests", []string{userID}, nil, nil)
+	return requests, err
+}
+
+// ApproveConsent shares the requested claims under a new token, returned with the consent receipt.
+// The owner secret is needed (WithSecret), requests made with a pseudonym are shared under it.
+func (c *Client) ApproveConsent(userID, requestID string, opts ...Option) (*Grant, error) {
+	token, err := NewShareToken()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := c.execute("approveConsent", []string{userID, requestID}, map[string][]byte{transientToken: []byte(token)}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Grant{Token: token, ReceiptID: string(payload)}, nil
+}
+
+// DeclineConsent declines a consent request, the owner secret is needed (WithSecret)
+func (c *Client) DeclineConsent(userID, requestID string, opts ...Option) error {
+	_, err := c.execute("declineConsent", []string{userID, requestID}, nil, opts)
+	return err
+}
+
+// QueryConsentReceipt returns a consent receipt
+func (c *Client) QueryConsentReceipt(receiptID string) (*ConsentReceipt, error) {
+	receipt := &ConsentReceipt{}
+	if err := c.queryJSON(receipt, "queryConsentReceipt", []string{receiptID}, nil, nil); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// QueryReceiptsByUser returns the consent receipts of the user, those issued under a pairwise
+// pseudonym only with WithSecret
+func (c *Client) QueryReceiptsByUser(userID string, opts ...Option) ([]ConsentReceipt, error) {
+	receipts := []ConsentReceipt{}
+	err := c.queryJSON(&receipts, "queryReceiptsByUser", []string{userID}, nil, opts)
+	return receipts, err
+}
+
+// QueryReceiptsByRelyingParty returns the consent receipts issued to a relying party
+func (c *Client) QueryReceiptsByRelyingParty(relyingParty string) ([]ConsentReceipt, error) {
+	receipts := []ConsentReceipt{}
+	err := c.queryJSON(&receipts, "queryReceiptsByRelyingParty", []string{relyingParty}, nil, nil)
+	return receipts, err
+}
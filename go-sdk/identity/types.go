@@ -0,0 +1,373 @@
+package identity
+
+// Types of claim values, see AddClaim
+const (
+	ClaimString  = "string"
+	ClaimNumber  = "number"
+	ClaimDate    = "date"
+	ClaimBoolean = "boolean"
+	ClaimObject  = "object"
+	ClaimArray   = "array"
+)
+
+// Attester metrics of AttesterLeaderboard
+const (
+	MetricRequests         = "requests"
+	MetricAttested         = "attested"
+	MetricRejected         = "rejected"
+	MetricRevoked          = "revoked"
+	MetricMedianTurnaround = "medianTurnaround"
+)
+
+// Decisions of ResolveDocConflict
+const (
+	DecisionHolder   = "holder"
+	DecisionClaimant = "claimant"
+)
+
+// Claim is the value of a claim with where it comes from
+type Claim struct {
+	Value       string         `json:"value"`
+	Source      string         `json:"source"`
+	SetBy       string         `json:"setBy,omitempty"`
+	Created     int64          `json:"created"`
+	Updated     int64          `json:"updated"`
+	TxID        string         `json:"txId"`
+	Attestation string         `json:"attestation,omitempty"`
+	Type        string         `json:"type,omitempty"`
+	Elements    []ClaimElement `json:"elements,omitempty"`
+}
+
+// ClaimElement is an element of an array claim, Type is empty for strings
+type ClaimElement struct {
+	ID          string `json:"id"`
+	Type        string `json:"type,omitempty"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Added       int64  `json:"added"`
+	TxID        string `json:"txId"`
+	Attestation string `json:"attestation,omitempty"`
+}
+
+// Credential is the access of a relying party to a claim
+type Credential struct {
+	TokenHash    string `json:"tokenHash"`
+	Salt         string `json:"salt"`
+	ValidDay     int    `json:"validDay"`
+	Granted      int64  `json:"granted,omitempty"`
+	Pseudonymous bool   `json:"pseudonymous,omitempty"`
+	SingleUse    bool   `json:"singleUse,omitempty"`
+	Redeemed     int64  `json:"redeemed,omitempty"`
+}
+
+// ID is the identity record of a user
+type ID struct {
+	Version    int                              `json:"version"`
+	Claims     map[string]Claim                 `json:"claims"`
+	Infoshared map[string]map[string]Credential `json:"infoshared"`
+	SecretHash string                           `json:"secretHash,omitempty"`
+	RedirectTo string                           `json:"redirectTo,omitempty"`
+}
+
+// Claims are the claims of a user as returned by QueryClaims
+type Claims struct {
+	User   string           `json:"user"`
+	Claims map[string]Claim `json:"claims"`
+}
+
+// SharedClaims are the claim values a relying party reads with AccessSharedClaims
+type SharedClaims struct {
+	User   string            `json:"user"`
+	Claims map[string]string `json:"claims"`
+}
+
+// UserClaims are the claims of a user in the requests or the attestations of an attester,
+// by claim name the claim url of a request or the hash of an attestation
+type UserClaims struct {
+	User   string            `json:"user"`
+	Claims map[string]string `json:"claims"`
+}
+
+// DocConflict is a document number claimed by two identities
+type DocConflict struct {
+	ConflictID string `json:"conflictId"`
+	DocHash    string `json:"docHash"`
+	Holder     string `json:"holder"`
+	Claimant   string `json:"claimant"`
+	Status     string `json:"status"`
+	Opened     int64  `json:"opened"`
+	Decision   string `json:"decision,omitempty"`
+	ResolvedBy string `json:"resolvedBy,omitempty"`
+	Resolved   int64  `json:"resolved,omitempty"`
+}
+
+// IndexResult is a batch of IndexDocIDs, Next is the start key of the next batch
+type IndexResult struct {
+	Indexed   int      `json:"indexed"`
+	Conflicts []string `json:"conflicts"`
+	Next      string   `json:"next"`
+}
+
+// Verdict is the result of IsClaimVerified
+type Verdict struct {
+	User     string `json:"user"`
+	Claim    string `json:"claim"`
+	Verified bool   `json:"verified"`
+	Attester string `json:"attester,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Party is an attester or a relying party and the org it belongs to
+type Party struct {
+	Name       string      `json:"name"`
+	Org        string      `json:"org"`
+	Controller *Controller `json:"controller,omitempty"`
+	Registered int64       `json:"registered"`
+	TxID       string      `json:"txId"`
+}
+
+// Controller are the details of a relying party that consent receipts name as the PII controller,
+// Contact, Email and PolicyURL are required
+type Controller struct {
+	Contact   string            `json:"contact"`
+	Address   map[string]string `json:"address,omitempty"`
+	Email     string            `json:"email"`
+	Phone     string            `json:"phone,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	PolicyURL string            `json:"policyUrl"`
+	Language  string            `json:"language,omitempty"`
+}
+
+// Accreditation allows an attester to attest a claim, Path goes from the trust root to the attester
+type Accreditation struct {
+	Attester   string   `json:"attester"`
+	Claim      string   `json:"claim"`
+	Accreditor string   `json:"accreditor"`
+	Path       []string `json:"path"`
+	MaxDepth   int      `json:"maxDepth"`
+	Org        string   `json:"org"`
+	Granted    int64    `json:"granted"`
+	Expires    int64    `json:"expires,omitempty"`
+	TxID       string   `json:"txId"`
+}
+
+// TrustVerdict is the result of TrustChain
+type TrustVerdict struct {
+	Attester string   `json:"attester"`
+	User     string   `json:"user"`
+	Claim    string   `json:"claim"`
+	Root     string   `json:"root"`
+	Trusted  bool     `json:"trusted"`
+	Path     []string `json:"path,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// AttesterStats are the counters and the median turnaround (seconds) of an attester
+type AttesterStats struct {
+	Attester         string `json:"attester"`
+	Requests         int64  `json:"requests"`
+	Attested         int64  `json:"attested"`
+	Rejected         int64  `json:"rejected"`
+	Revoked          int64  `json:"revoked"`
+	Pending          int64  `json:"pending"`
+	MedianTurnaround int64  `json:"medianTurnaround"`
+	Turnarounds      int64  `json:"turnarounds"`
+}
+
+// RateLimit limits the attestation requests of every requester to an attester, zero values disable a limit
+type RateLimit struct {
+	MaxRequests int   `json:"maxRequests"`
+	Window      int64 `json:"window"`
+	Cooldown    int64 `json:"cooldown"`
+	Deposit     int64 `json:"deposit"`
+}
+
+// Deposit is the deposit balance of the caller
+type Deposit struct {
+	Requester string `json:"requester"`
+	Balance   int64  `json:"balance"`
+}
+
+// Share are the terms of a claim shared with ShareInfo, a zero ValidDays takes the default of the claim schema
+type Share struct {
+	ValidDays    int
+	Purpose      string
+	Jurisdiction string
+	SingleUse    bool
+}
+
+// Grant is the outcome of sharing claims: the token to hand to the relying party and the consent receipt
+type Grant struct {
+	Token     string `json:"token"`
+	ReceiptID string `json:"receiptId"`
+}
+
+// Redemption is the result of RedeemShareToken, Expires is zero for shares without a grant time
+type Redemption struct {
+	Claim        string `json:"claim"`
+	RelyingParty string `json:"relyingParty"`
+	SingleUse    bool   `json:"singleUse"`
+	Expires      int64  `json:"expires,omitempty"`
+}
+
+// AccessLogEntry records a relying party reading claims shared by a user, and the client that read them
+type AccessLogEntry struct {
+	RelyingParty string   `json:"relyingParty"`
+	CallerMSP    string   `json:"callerMsp"`
+	Caller       string   `json:"caller"`
+	Claims       []string `json:"claims"`
+	Timestamp    int64    `json:"timestamp"`
+	TxID         string   `json:"txId"`
+}
+
+// ConsentRequest is a request of a relying party to access claims of a user
+type ConsentRequest struct {
+	RequestID    string   `json:"requestId"`
+	User         string   `json:"user"`
+	RelyingParty string   `json:"relyingParty"`
+	Claims       []string `json:"claims"`
+	Purpose      string   `json:"purpose"`
+	Jurisdiction string   `json:"jurisdiction,omitempty"`
+	ValidDays    int      `json:"validDays"`
+	Status       string   `json:"status"`
+	Requested    int64    `json:"requested"`
+	Decided      int64    `json:"decided,omitempty"`
+	Pseudonymous bool     `json:"pseudonymous,omitempty"`
+}
+
+// ConsentReceipt is a Kantara consent receipt issued when claims are shared
+type ConsentReceipt struct {
+	Version          string          `json:"version"`
+	Jurisdiction     string          `json:"jurisdiction"`
+	ConsentTimestamp int64           `json:"consentTimestamp"`
+	CollectionMethod string          `json:"collectionMethod"`
+	ConsentReceiptID string          `json:"consentReceiptID"`
+	Language         string          `json:"language"`
+	PiiPrincipalID   string          `json:"piiPrincipalId"`
+	PiiControllers   []PiiController `json:"piiControllers"`
+	PolicyURL        string          `json:"policyUrl"`
+	Services         []Service       `json:"services"`
+	Sensitive        bool            `json:"sensitive"`
+	SpiCat           []string        `json:"spiCat"`
+}
+
+type PiiController struct {
+	PiiController    string            `json:"piiController"`
+	OnBehalf         bool              `json:"onBehalf"`
+	Contact          string            `json:"contact"`
+	Address          map[string]string `json:"address,omitempty"`
+	Email            string            `json:"email"`
+	Phone            string            `json:"phone,omitempty"`
+	PiiControllerURL string            `json:"piiControllerUrl,omitempty"`
+}
+
+type Service struct {
+	Service  string    `json:"service"`
+	Purposes []Purpose `json:"purposes"`
+}
+
+type Purpose struct {
+	Purpose              string   `json:"purpose"`
+	ConsentType          string   `json:"consentType"`
+	PiiCategory          []string `json:"piiCategory"`
+	PrimaryPurpose       bool     `json:"primaryPurpose"`
+	Termination          string   `json:"termination"`
+	ThirdPartyDisclosure bool     `json:"thirdPartyDisclosure"`
+}
+
+// InvoiceLine is the usage of a kind in a billing period
+type InvoiceLine struct {
+	Quantity  int64 `json:"quantity"`
+	UnitPrice int64 `json:"unitPrice"`
+	Amount    int64 `json:"amount"`
+}
+
+// Invoice is the usage of a party in a billing period, Closed is zero while the period is open
+type Invoice struct {
+	Party    string                 `json:"party"`
+	Period   string                 `json:"period"`
+	Lines    map[string]InvoiceLine `json:"lines"`
+	Total    int64                  `json:"total"`
+	Closed   int64                  `json:"closed,omitempty"`
+	Disputed bool                   `json:"disputed,omitempty"`
+	Dispute  *Dispute               `json:"dispute,omitempty"`
+}
+
+type Dispute struct {
+	Reason     string `json:"reason"`
+	RaisedBy   string `json:"raisedBy"`
+	Raised     int64  `json:"raised"`
+	Resolution string `json:"resolution,omitempty"`
+	Resolved   int64  `json:"resolved,omitempty"`
+}
+
+// PeriodSummary is the result of CloseBillingPeriod
+type PeriodSummary struct {
+	Period   string `json:"period"`
+	Invoices int    `json:"invoices"`
+}
+
+// ClaimSchema describes a claim type users can add and attesters can attest
+type ClaimSchema struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern,omitempty"`
+	JSONSchema  string   `json:"jsonSchema,omitempty"`
+	Sensitivity string   `json:"sensitivity"`
+	Attesters   []string `json:"attesters"`
+	ValidDays   int      `json:"validDays"`
+}
+
+// IdentityRecord is an identity of ImportIdentities and ExportIdentities. Types holds the type of the
+// claims that are not strings, SecretHash binds the identity to an owner secret, see OwnerSecretHash.
+type IdentityRecord struct {
+	ID         string            `json:"id"`
+	Claims     map[string]string `json:"claims"`
+	Types      map[string]string `json:"types,omitempty"`
+	SecretHash string            `json:"secretHash,omitempty"`
+}
+
+// ImportResult is the outcome of importing a record: created, unchanged, conflict or invalid
+type ImportResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ExportPage is a page of ExportIdentities, Bookmark is where the next page starts
+type ExportPage struct {
+	Records  []IdentityRecord `json:"records"`
+	Fetched  int32            `json:"fetched"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// MigrationState tracks a resumable migration of the ledger to Version
+type MigrationState struct {
+	Version  int    `json:"version"`
+	Cursor   string `json:"cursor"`
+	Migrated int    `json:"migrated"`
+	Done     bool   `json:"done"`
+}
+
+// KeyPolicy are the organizations that must endorse changes of a key
+type KeyPolicy struct {
+	Key  string   `json:"key"`
+	Orgs []string `json:"orgs"`
+}
+
+// FunctionDescription is a function of the chaincode as returned by Describe
+type FunctionDescription struct {
+	Name     string           `json:"name"`
+	Aliases  []string         `json:"aliases,omitempty"`
+	ReadOnly bool             `json:"readOnly"`
+	Args     []ArgDescription `json:"args"`
+	Roles    []string         `json:"roles,omitempty"`
+	Returns  string           `json:"returns,omitempty"`
+}
+
+type ArgDescription struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Optional  bool   `json:"optional,omitempty"`
+	Transient string `json:"transient,omitempty"`
+	Sealed    bool   `json:"sealed,omitempty"`
+}
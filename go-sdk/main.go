@@ -1,128 +1,156 @@
+/*
+ * Command line tool of the identity chaincode.
+ *
+ *   go-sdk [connection flags] <command> [command flags] <args>
+ *
+ * The connection flags default to the environment (IDENTITY_CONFIG, IDENTITY_CHANNEL,
+ * IDENTITY_CHAINCODE, IDENTITY_USER, IDENTITY_ORG, IDENTITY_OUTPUT, IDENTITY_SECRET,
+ * IDENTITY_CLAIM_KEY) and then to the basic-network settings. Run it without a command for the
+ * list of commands.
+ */
 package main
 
-import(
-  "fmt"
-  "strconv"
-  "github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
-  "github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
-  "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-  "github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hendry19901990/fabric-identity/go-sdk/identity"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 )
 
+// Output formats
 const (
-  channelID      = "mychannel"
-  orgName        = "Org1"
-  orgAdmin       = "Admin"
-  ordererOrgName = "OrdererOrg"
+	outputJSON  = "json"
+	outputTable = "table"
 )
 
-const (
-  fileConfig = "config_test.yaml"
-  create_Channel = false
-)
-
-// Initial B values for ExampleCC
-const (
-  ExampleCCInitB    = "200"
-  ExampleCCUpgradeB = "400"
-  keyExp            = "key-%s-%s"
-)
-
-
-var (
-  ccID = "mycc"
-)
-
-// ExampleCC query and transaction arguments
-var defaultQueryArgs = [][]byte{[]byte("query"), []byte("b")}
-var defaultTxArgs = [][]byte{[]byte("move"), []byte("a"), []byte("b"), []byte("1")}
-
-// ExampleCC init and upgrade args
-var initArgs = [][]byte{[]byte("init"), []byte("a"), []byte("100"), []byte("b"), []byte(ExampleCCInitB)}
-var resetArgs = [][]byte{[]byte("a"), []byte("100"), []byte("b"), []byte(ExampleCCInitB)}
-
-
-//TODO Args
-func queryCC(client *channel.Client, targetEndpoints ...string) []byte {
-  response, err := client.Query(channel.Request{ChaincodeID: ccID, Fcn: "query", Args: ExampleCCDefaultQueryArgs()},
-    channel.WithRetry(retry.DefaultChannelOpts),
-    channel.WithTargetEndpoints(targetEndpoints...),
-  )
-  if err != nil {
-    fmt.Println(err)
-  }
-  return response.Payload
-}
-
-func executeCC(client *channel.Client) {
-  _, err := client.Execute(channel.Request{ChaincodeID: ccID, Fcn: "invoke", Args: ExampleCCDefaultTxArgs()},
-    channel.WithRetry(retry.DefaultChannelOpts))
-  if err != nil {
-    fmt.Println(err)
-  }
+// settings are the connection flags shared by every command
+type settings struct {
+	config    string
+	channelID string
+	ccID      string
+	user      string
+	org       string
+	output    string
+	secret    string
+	claimKey  string
 }
 
-// ExampleCCDefaultQueryArgs returns example cc query args
-func ExampleCCDefaultQueryArgs() [][]byte {
-  return defaultQueryArgs
+// env returns the environment variable name, or def when it is not set
+func env(name string, def string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return def
 }
 
-// ExampleCCQueryArgs returns example cc query args
-func ExampleCCQueryArgs(key string) [][]byte {
-  return [][]byte{[]byte("query"), []byte(key)}
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
 
-// ExampleCCTxArgs returns example cc query args
-func ExampleCCTxArgs(from, to, val string) [][]byte {
-  return [][]byte{[]byte("move"), []byte(from), []byte(to), []byte(val)}
+func run(argv []string) int {
+	s := settings{}
+	global := flag.NewFlagSet(program(), flag.ContinueOnError)
+	global.StringVar(&s.config, "config", env("IDENTITY_CONFIG", "config_test.yaml"), "connection profile")
+	global.StringVar(&s.channelID, "channel", env("IDENTITY_CHANNEL", "mychannel"), "channel of the chaincode")
+	global.StringVar(&s.ccID, "chaincode", env("IDENTITY_CHAINCODE", identity.DefaultChaincodeID), "name of the identity chaincode")
+	global.StringVar(&s.user, "user", env("IDENTITY_USER", "User1"), "user of the connection profile to sign with")
+	global.StringVar(&s.org, "org", env("IDENTITY_ORG", "Org1"), "organization of the user")
+	global.StringVar(&s.output, "output", env("IDENTITY_OUTPUT", outputTable), "output format, json or table")
+	global.StringVar(&s.secret, "secret", env("IDENTITY_SECRET", ""), "owner secret of the user, sent in the transient map")
+	global.StringVar(&s.claimKey, "claim-key", env("IDENTITY_CLAIM_KEY", ""), "base64 AES-256 key of encrypted claims, sent in the transient map")
+	global.Usage = func() { usage(global) }
+	if err := global.Parse(argv); err != nil {
+		return 2
+	}
+	if s.output != outputJSON && s.output != outputTable {
+		fmt.Fprintf(os.Stderr, "Unknown output %s, expecting %s or %s\n", s.output, outputJSON, outputTable)
+		return 2
+	}
+
+	cmd, args := findCommand(global.Args())
+	if cmd == nil {
+		usage(global)
+		return 2
+	}
+	flags := flag.NewFlagSet(program()+" "+cmd.path, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n\n%s\n", program(), cmd.path, cmd.args, cmd.help)
+		flags.PrintDefaults()
+	}
+	runner := cmd.setup(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if err := cmd.check(flags.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		return 2
+	}
+	opts, err := s.options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	sdk, err := fabsdk.New(config.FromFile(s.config))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer sdk.Close()
+	client, err := channel.New(sdk.ChannelContext(s.channelID, fabsdk.WithUser(s.user), fabsdk.WithOrg(s.org)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	session := &session{ids: identity.New(client, s.ccID), opts: opts}
+	if s.secret != "" {
+		session.secret = []byte(s.secret)
+	}
+	result, err := runner(session, flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := render(os.Stdout, s.output, result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
 
-// ExampleCCDefaultTxArgs returns example cc move funds args
-func ExampleCCDefaultTxArgs() [][]byte {
-  return defaultTxArgs
+// options are the transient values of the connection flags
+func (s settings) options() ([]identity.Option, error) {
+	opts := []identity.Option{}
+	if s.secret != "" {
+		opts = append(opts, identity.WithSecret([]byte(s.secret)))
+	}
+	if s.claimKey != "" {
+		key, err := base64.StdEncoding.DecodeString(s.claimKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("The claim key must be a base64 encoded 32 bytes AES-256 key")
+		}
+		opts = append(opts, identity.WithClaimKey(key))
+	}
+	return opts, nil
 }
 
-
-
-//ExampleCCTxSetArgs sets the given key value in examplecc
-func ExampleCCTxSetArgs(key, value string) [][]byte {
-  return [][]byte{[]byte("set"), []byte(key), []byte(value)}
+func program() string {
+	return filepath.Base(os.Args[0])
 }
 
-//ExampleCCInitArgs returns example cc initialization args
-func ExampleCCInitArgs() [][]byte {
-  return initArgs
-}
-
-func main() {
-
-  sdk, err := fabsdk.New(config.FromFile(fileConfig))
-  if err != nil {
-    fmt.Println(err)
-  }
-  defer sdk.Close()
-
-
-  //prepare channel client context using client context
-  clientChannelContext := sdk.ChannelContext(channelID, fabsdk.WithUser("User1"), fabsdk.WithOrg(orgName))
-  // Channel client is used to query and execute transactions (Org1 is default org)
-  client, err := channel.New(clientChannelContext)
-  if err != nil {
-   fmt.Println(err)
-  }
-
-  // Query
-  existingValue := queryCC(client)
-  valueInt, err := strconv.Atoi(string(existingValue))
-  if err != nil {
-   fmt.Println(err)
-  }else{
-    fmt.Println(valueInt)
-  }
-
-  //execute transaction
-
-  executeCC(client)
-
-
+func usage(global *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] <command> [command flags] <args>\n\ncommands:\n", program())
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-26s %s\n", cmd.path, cmd.help)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	global.PrintDefaults()
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// tabler is a result with its own table layout
+type tabler interface {
+	table() ([]string, [][]string)
+}
+
+// render prints the result of a command as indented JSON or as a table, nothing for a nil result
+func render(w io.Writer, format string, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	if format == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	if t, ok := result.(tabler); ok {
+		header, rows := t.table()
+		return writeTable(w, header, rows)
+	}
+
+	// other results are laid out from their JSON form: arrays of objects get a column per
+	// field, objects a row per field
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(resultAsBytes, &doc); err != nil {
+		return err
+	}
+	switch v := doc.(type) {
+	case []interface{}:
+		columns := []string{}
+		seen := map[string]bool{}
+		for _, item := range v {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				columns = nil
+				break
+			}
+			for field := range object {
+				if !seen[field] {
+					seen[field] = true
+					columns = append(columns, field)
+				}
+			}
+		}
+		if columns == nil {
+			rows := [][]string{}
+			for _, item := range v {
+				rows = append(rows, []string{cell(item)})
+			}
+			return writeTable(w, []string{"VALUE"}, rows)
+		}
+		sort.Strings(columns)
+		rows := [][]string{}
+		for _, item := range v {
+			object := item.(map[string]interface{})
+			row := make([]string, len(columns))
+			for i, field := range columns {
+				row[i] = cell(object[field])
+			}
+			rows = append(rows, row)
+		}
+		header := make([]string, len(columns))
+		for i, field := range columns {
+			header[i] = strings.ToUpper(field)
+		}
+		return writeTable(w, header, rows)
+	case map[string]interface{}:
+		fields := make([]string, 0, len(v))
+		for field := range v {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		rows := [][]string{}
+		for _, field := range fields {
+			rows = append(rows, []string{field, cell(v[field])})
+		}
+		return writeTable(w, []string{"FIELD", "VALUE"}, rows)
+	}
+	_, err = fmt.Fprintln(w, cell(doc))
+	return err
+}
+
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// cell is a value of a table, nested values are printed as compact JSON
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	valueAsBytes, _ := json.Marshal(value)
+	return string(valueAsBytes)
+}